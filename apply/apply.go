@@ -3,6 +3,7 @@ package apply
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -32,10 +33,70 @@ import (
 
 const DefaultDecoderBufferSize = 500
 
+// fieldManager is the field manager name of server-side apply.
+const fieldManager = "k8sutil"
+
+const (
+	SubresourceStatus = "status"
+	SubresourceScale  = "scale"
+)
+
+// Operation is the action taken on an object when it was applied, the values are
+// the same as the `kubectl apply` output.
+type Operation string
+
+const (
+	OperationCreated    Operation = "created"
+	OperationConfigured Operation = "configured"
+	OperationUnchanged  Operation = "unchanged"
+	// OperationSkipped means the object already exists and is not applied, see ApplyModeCreateOrSkip.
+	OperationSkipped Operation = "skipped"
+)
+
+const (
+	// ApplyModeAnnotation changes how the object is applied, the default is apply.
+	ApplyModeAnnotation = "k8sutil.io/apply-mode"
+
+	// ApplyModeCreateOnly creates the object, it fails if the object already exists.
+	ApplyModeCreateOnly = "create-only"
+	// ApplyModeCreateOrSkip creates the object if it doesn't exist, the existing object is never changed.
+	ApplyModeCreateOrSkip = "create-or-skip"
+	// ApplyModeGenerate creates a new object with the metadata.generateName every time.
+	ApplyModeGenerate = "generate"
+)
+
+// Result is the result of applying a single object.
+type Result struct {
+	GroupVersionKind schema.GroupVersionKind `json:"groupVersionKind"`
+	Namespace        string                  `json:"namespace,omitempty"`
+	Name             string                  `json:"name"`
+	Subresource      string                  `json:"subresource,omitempty"`
+	Operation        Operation               `json:"operation"`
+	// Object is the object returned by the server, it's the current object when the operation is unchanged.
+	// When the Subresource is scale, the Object is the autoscaling/v1 Scale returned by the server,
+	// while the GroupVersionKind is still the kind of the applied object.
+	Object *unstructured.Unstructured `json:"-"`
+}
+
+func newResult(obj *unstructured.Unstructured, operation Operation) *Result {
+	return &Result{
+		GroupVersionKind: obj.GroupVersionKind(),
+		Namespace:        obj.GetNamespace(),
+		Name:             obj.GetName(),
+		Operation:        operation,
+		Object:           obj,
+	}
+}
+
 type applyOptions struct {
 	dynamicClient   dynamic.Interface
 	discoveryClient discovery.DiscoveryInterface
 	serverSide      bool
+	// secretServerSide forces the Secret to be applied with server-side apply, so the Secret data
+	// is never copied into the last-applied-configuration annotation.
+	secretServerSide bool
+	// subresource is the subresource applied instead of the object, only status and scale are supported.
+	subresource string
 }
 
 func NewApplyOptions(dynamicClient dynamic.Interface, discoveryClient discovery.DiscoveryInterface) *applyOptions {
@@ -50,6 +111,21 @@ func (o *applyOptions) WithServerSide(serverSide bool) *applyOptions {
 	return o
 }
 
+// WithSecretServerSide always applies the Secret with server-side apply, and removes the
+// last-applied-configuration annotation from the existing Secret.
+func (o *applyOptions) WithSecretServerSide(secretServerSide bool) *applyOptions {
+	o.secretServerSide = secretServerSide
+	return o
+}
+
+// WithSubresource applies the subresource (status or scale) of the object instead of the whole object.
+// The status is taken from the object status, and the scale is taken from the object spec.replicas.
+// The Result of the scale subresource holds the returned Scale object, see Result.Object.
+func (o *applyOptions) WithSubresource(subresource string) *applyOptions {
+	o.subresource = subresource
+	return o
+}
+
 func (o *applyOptions) ToRESTMapper() (meta.RESTMapper, error) {
 	gr, err := restmapper.GetAPIGroupResources(o.discoveryClient)
 	if err != nil {
@@ -61,24 +137,34 @@ func (o *applyOptions) ToRESTMapper() (meta.RESTMapper, error) {
 }
 
 func (o *applyOptions) Apply(ctx context.Context, data []byte) error {
+	_, err := o.ApplyWithResults(ctx, data)
+	return err
+}
+
+// ApplyWithResults applies all objects in data, and returns the result of each applied object.
+// When an error occurs, the results of the objects applied before it are returned with the error.
+func (o *applyOptions) ApplyWithResults(ctx context.Context, data []byte) ([]Result, error) {
 	restmapper, err := o.ToRESTMapper()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	unstructList, err := Decode(data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	results := make([]Result, 0, len(unstructList))
 	for _, unstruct := range unstructList {
-		klog.V(5).Infof("Apply object: %#v", unstruct)
-		if _, err := ApplyUnstructured(ctx, o.dynamicClient, restmapper, unstruct, o.serverSide); err != nil {
-			return err
+		klog.V(5).Infof("Apply object: %#v", Redact(&unstruct))
+		result, err := o.ApplyUnstructured(ctx, restmapper, unstruct)
+		if err != nil {
+			return results, err
 		}
-		klog.V(2).Infof("%s/%s applyed", strings.ToLower(unstruct.GetKind()), unstruct.GetName())
+		results = append(results, *result)
+		klog.V(2).Infof("%s/%s %s", strings.ToLower(unstruct.GetKind()), unstruct.GetName(), result.Operation)
 	}
-	return nil
+	return results, nil
 }
 
 func Decode(data []byte) ([]unstructured.Unstructured, error) {
@@ -93,7 +179,8 @@ func Decode(data []byte) ([]unstructured.Unstructured, error) {
 			lastErr = err
 			break
 		}
-		klog.V(5).Infof("The section:[%d] raw content: %s", i, string(reqObj.Raw))
+		// Don't log the raw content, it may be a Secret.
+		klog.V(5).Infof("The section:[%d] raw content length: %d", i, len(reqObj.Raw))
 		if len(reqObj.Raw) == 0 {
 			continue
 		}
@@ -104,13 +191,12 @@ func Decode(data []byte) ([]unstructured.Unstructured, error) {
 			klog.Info(lastErr)
 			break
 		}
-		klog.V(5).Infof("The section:[%d] GroupVersionKind: %#v  object: %#v", i, gvk, obj)
-
 		unstruct, err := util.ConvertSingleObjectToUnstructured(obj)
 		if err != nil {
 			lastErr = errors.Wrapf(err, "serialize the section:[%d] content error", i)
 			break
 		}
+		klog.V(5).Infof("The section:[%d] GroupVersionKind: %#v  object: %#v", i, gvk, Redact(&unstruct))
 		unstructList = append(unstructList, unstruct)
 		i++
 	}
@@ -122,14 +208,37 @@ func Decode(data []byte) ([]unstructured.Unstructured, error) {
 	return unstructList, nil
 }
 
+// ApplyUnstructured applies the object to the cluster, and returns the object from the server.
+// If nothing changed, the current object is returned without any write.
+// Use applyOptions.WithSubresource to apply the status or scale subresource.
 func ApplyUnstructured(ctx context.Context, dynamicClient dynamic.Interface, restMapper meta.RESTMapper, unstructuredObj unstructured.Unstructured, serverSide bool) (*unstructured.Unstructured, error) {
+	result, err := NewApplyOptions(dynamicClient, nil).WithServerSide(serverSide).ApplyUnstructured(ctx, restMapper, unstructuredObj)
+	if err != nil {
+		return nil, err
+	}
+	return result.Object, nil
+}
 
-	if len(unstructuredObj.GetName()) == 0 {
-		metadata, _ := meta.Accessor(unstructuredObj)
-		generateName := metadata.GetGenerateName()
-		if len(generateName) > 0 {
-			return nil, fmt.Errorf("from %s: cannot use generate name with apply", generateName)
+// ApplyUnstructured applies the object to the cluster, and returns the operation it taken.
+// The client-side apply skips the patch if the three-way patch is empty, the server-side apply
+// reports the object unchanged if the resourceVersion is not changed after apply.
+func (o *applyOptions) ApplyUnstructured(ctx context.Context, restMapper meta.RESTMapper, unstructuredObj unstructured.Unstructured) (*Result, error) {
+	mode := unstructuredObj.GetAnnotations()[ApplyModeAnnotation]
+	switch mode {
+	case "", ApplyModeCreateOnly, ApplyModeCreateOrSkip:
+		if len(unstructuredObj.GetName()) == 0 {
+			generateName := unstructuredObj.GetGenerateName()
+			if len(generateName) > 0 {
+				return nil, fmt.Errorf("from %s: cannot use generate name with apply, set the annotation %s: %s to create it", generateName, ApplyModeAnnotation, ApplyModeGenerate)
+			}
+		}
+	case ApplyModeGenerate:
+		if len(unstructuredObj.GetGenerateName()) == 0 {
+			return nil, fmt.Errorf("%s: the apply mode %s requires generate name", unstructuredObj.GetName(), ApplyModeGenerate)
 		}
+		unstructuredObj.SetName("")
+	default:
+		return nil, fmt.Errorf("%s: unknown apply mode %s", unstructuredObj.GetName(), mode)
 	}
 
 	b, err := unstructuredObj.MarshalJSON()
@@ -153,9 +262,25 @@ func ApplyUnstructured(ctx context.Context, dynamicClient dynamic.Interface, res
 		if unstructuredObj.GetNamespace() == "" {
 			unstructuredObj.SetNamespace("default")
 		}
-		dri = dynamicClient.Resource(mapping.Resource).Namespace(unstructuredObj.GetNamespace())
+		dri = o.dynamicClient.Resource(mapping.Resource).Namespace(unstructuredObj.GetNamespace())
 	} else {
-		dri = dynamicClient.Resource(mapping.Resource)
+		dri = o.dynamicClient.Resource(mapping.Resource)
+	}
+
+	if mode != "" {
+		if o.subresource != "" {
+			return nil, fmt.Errorf("%s: the apply mode %s can't be used with subresource %s", unstructuredObj.GetName(), mode, o.subresource)
+		}
+		return create(ctx, dri, &unstructuredObj, mode)
+	}
+
+	serverSide := o.serverSide
+	if o.secretServerSide && isSecret(&unstructuredObj) {
+		serverSide = true
+	}
+
+	if o.subresource != "" {
+		return applySubresource(ctx, dri, &unstructuredObj, o.subresource, serverSide)
 	}
 
 	if serverSide {
@@ -166,17 +291,45 @@ func ApplyUnstructured(ctx context.Context, dynamicClient dynamic.Interface, res
 			unstructuredObj.SetAnnotations(annotations)
 		}
 		unstructuredObj.SetManagedFields(nil)
-		klog.V(4).Infof("Need remove managedFields before apply, %#v", unstructuredObj)
+		klog.V(4).Infof("Need remove managedFields before apply, %#v", Redact(&unstructuredObj))
+
+		data, err := unstructuredObj.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+
+		current, err := dri.Get(ctx, unstructuredObj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("retrieving current configuration of:\n%s\nfrom server for:%v", unstructuredObj.GetName(), err)
+			}
+			current = nil
+		}
+
+		if current != nil && o.secretServerSide && isSecret(current) {
+			if err := removeLastAppliedAnnotation(ctx, dri, current); err != nil {
+				return nil, err
+			}
+		}
 
 		force := true
-		opts := metav1.PatchOptions{FieldManager: "k8sutil", Force: &force}
-		if _, err := dri.Patch(ctx, unstructuredObj.GetName(), types.ApplyPatchType, b, opts); err != nil {
+		opts := metav1.PatchOptions{FieldManager: fieldManager, Force: &force}
+		patched, err := dri.Patch(ctx, unstructuredObj.GetName(), types.ApplyPatchType, data, opts)
+		if err != nil {
 			if isIncompatibleServerError(err) {
 				err = fmt.Errorf("server-side apply not available on the server: (%v)", err)
 			}
 			return nil, err
 		}
-		return nil, nil
+
+		switch {
+		case current == nil:
+			return newResult(patched, OperationCreated), nil
+		case current.GetResourceVersion() == patched.GetResourceVersion():
+			klog.V(2).Infof("The resource %s unchanged", unstructuredObj.GetName())
+			return newResult(patched, OperationUnchanged), nil
+		}
+		return newResult(patched, OperationConfigured), nil
 	}
 
 	modified, err := util.GetModifiedConfiguration(obj, true, unstructured.UnstructuredJSONScheme)
@@ -197,7 +350,11 @@ func ApplyUnstructured(ctx context.Context, dynamicClient dynamic.Interface, res
 			return nil, fmt.Errorf("creating %s error: %v", unstructuredObj.GetName(), err)
 		}
 
-		return dri.Create(ctx, &unstructuredObj, metav1.CreateOptions{})
+		created, err := dri.Create(ctx, &unstructuredObj, metav1.CreateOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return newResult(created, OperationCreated), nil
 	}
 
 	klog.V(2).Infof("The resource %s apply", unstructuredObj.GetName())
@@ -211,13 +368,147 @@ func ApplyUnstructured(ctx context.Context, dynamicClient dynamic.Interface, res
 	if err != nil {
 		return nil, err
 	}
-	return dri.Patch(ctx, unstructuredObj.GetName(), patchType, patchBytes, metav1.PatchOptions{})
+	if isEmptyPatch(patchBytes) {
+		klog.V(2).Infof("The resource %s unchanged", unstructuredObj.GetName())
+		return newResult(currentUnstr, OperationUnchanged), nil
+	}
+
+	patched, err := dri.Patch(ctx, unstructuredObj.GetName(), patchType, patchBytes, metav1.PatchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return newResult(patched, OperationConfigured), nil
+}
+
+// applySubresource patches the status or scale subresource of the existing object, use server-side apply
+// if serverSide is true, otherwise use json merge patch.
+func applySubresource(ctx context.Context, dri dynamic.ResourceInterface, obj *unstructured.Unstructured, subresource string, serverSide bool) (*Result, error) {
+	var patch map[string]interface{}
+	switch subresource {
+	case SubresourceStatus:
+		status, found, err := unstructured.NestedFieldNoCopy(obj.Object, "status")
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: the object has no status", obj.GetName())
+		}
+		patch = map[string]interface{}{"status": status}
+		if serverSide {
+			patch["apiVersion"] = obj.GetAPIVersion()
+			patch["kind"] = obj.GetKind()
+		}
+	case SubresourceScale:
+		replicas, found, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: the object has no spec.replicas", obj.GetName())
+		}
+		patch = map[string]interface{}{"spec": map[string]interface{}{"replicas": replicas}}
+		if serverSide {
+			patch["apiVersion"] = "autoscaling/v1"
+			patch["kind"] = "Scale"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported subresource %s, only %s and %s are supported", subresource, SubresourceStatus, SubresourceScale)
+	}
+
+	patchType := types.MergePatchType
+	opts := metav1.PatchOptions{}
+	if serverSide {
+		patch["metadata"] = map[string]interface{}{"name": obj.GetName(), "namespace": obj.GetNamespace()}
+		force := true
+		patchType = types.ApplyPatchType
+		opts = metav1.PatchOptions{FieldManager: fieldManager, Force: &force}
+	}
+
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := dri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("retrieving current configuration of:\n%s\nfrom server for:%v", obj.GetName(), err)
+	}
+
+	klog.V(2).Infof("The resource %s apply subresource %s", obj.GetName(), subresource)
+	patched, err := dri.Patch(ctx, obj.GetName(), patchType, data, opts, subresource)
+	if err != nil {
+		if serverSide && isIncompatibleServerError(err) {
+			err = fmt.Errorf("server-side apply not available on the server: (%v)", err)
+		}
+		return nil, err
+	}
+
+	operation := OperationConfigured
+	if current.GetResourceVersion() == patched.GetResourceVersion() {
+		operation = OperationUnchanged
+	}
+	result := newResult(patched, operation)
+	// the scale subresource returns the Scale object, report the kind of the applied object,
+	// so the result can be mapped to the workload, e.g. by WaitForReady
+	result.GroupVersionKind = obj.GroupVersionKind()
+	result.Subresource = subresource
+	return result, nil
+}
+
+// create creates the object according to the apply mode, the last-applied-configuration annotation
+// is not set because the object is never applied.
+func create(ctx context.Context, dri dynamic.ResourceInterface, obj *unstructured.Unstructured, mode string) (*Result, error) {
+	if mode == ApplyModeCreateOrSkip {
+		current, err := dri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err == nil {
+			klog.V(2).Infof("The resource %s already exists, skip it", obj.GetName())
+			return newResult(current, OperationSkipped), nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("retrieving current configuration of:\n%s\nfrom server for:%v", obj.GetName(), err)
+		}
+	}
+
+	klog.V(2).Infof("The resource %s%s creating", obj.GetName(), obj.GetGenerateName())
+	created, err := dri.Create(ctx, obj, metav1.CreateOptions{})
+	if err != nil {
+		if apierrors.IsAlreadyExists(err) && mode == ApplyModeCreateOrSkip {
+			// the object was created by others after we got it
+			current, err := dri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			return newResult(current, OperationSkipped), nil
+		}
+		return nil, err
+	}
+	return newResult(created, OperationCreated), nil
+}
+
+// removeLastAppliedAnnotation removes the last-applied-configuration annotation from the current object
+// which was applied by client-side apply before.
+func removeLastAppliedAnnotation(ctx context.Context, dri dynamic.ResourceInterface, current *unstructured.Unstructured) error {
+	if _, ok := current.GetAnnotations()[corev1.LastAppliedConfigAnnotation]; !ok {
+		return nil
+	}
+
+	klog.V(2).Infof("Remove the last-applied-configuration annotation from %s", current.GetName())
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:null}}}`, corev1.LastAppliedConfigAnnotation)
+	if _, err := dri.Patch(ctx, current.GetName(), types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("removing the last-applied-configuration annotation from %s: %v", current.GetName(), err)
+	}
+	return nil
+}
+
+// isEmptyPatch returns true if the patch changes nothing.
+func isEmptyPatch(patch []byte) bool {
+	return len(patch) == 0 || string(patch) == "{}"
 }
 
 func Patch(currentUnstr *unstructured.Unstructured, modified []byte, name string, gvk schema.GroupVersionKind) ([]byte, types.PatchType, error) {
 	current, err := currentUnstr.MarshalJSON()
 	if err != nil {
-		return nil, "", fmt.Errorf("serializing current configuration from: %v, %v", currentUnstr, err)
+		return nil, "", fmt.Errorf("serializing current configuration from: %v, %v", Redact(currentUnstr), err)
 	}
 
 	original, err := util.GetOriginalConfiguration(currentUnstr)
@@ -0,0 +1,396 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testRESTMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}, meta.RESTScopeNamespace)
+	return mapper
+}
+
+// testWidget returns a custom resource which is not registered in the Scheme, so it's patched by json merge patch.
+func testWidget(spec map[string]interface{}) unstructured.Unstructured {
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata": map[string]interface{}{
+			"name":      "demo",
+			"namespace": "default",
+		},
+		"spec": spec,
+	}}
+}
+
+func TestApplyUnstructuredUnchanged(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "WidgetList"})
+	o := NewApplyOptions(client, nil)
+	mapper := testRESTMapper()
+
+	result, err := o.ApplyUnstructured(context.TODO(), mapper, testWidget(map[string]interface{}{"foo": "bar"}))
+	assert.Nil(t, err)
+	assert.Equal(t, OperationCreated, result.Operation)
+
+	client.ClearActions()
+	result, err = o.ApplyUnstructured(context.TODO(), mapper, testWidget(map[string]interface{}{"foo": "bar"}))
+	assert.Nil(t, err)
+	assert.Equal(t, OperationUnchanged, result.Operation)
+	for _, action := range client.Actions() {
+		assert.NotEqual(t, "patch", action.GetVerb())
+	}
+
+	client.ClearActions()
+	result, err = o.ApplyUnstructured(context.TODO(), mapper, testWidget(map[string]interface{}{"foo": "baz"}))
+	assert.Nil(t, err)
+	assert.Equal(t, OperationConfigured, result.Operation)
+	assert.Equal(t, "baz", result.Object.Object["spec"].(map[string]interface{})["foo"])
+}
+
+// serverSideApplyReactor applies the apply patch to the object in the tracker of the fake client, which doesn't
+// support server-side apply. The fields except the metadata are replaced, and the resourceVersion is increased
+// only if the object is changed. The other patches are handled by the fake client.
+func serverSideApplyReactor(client *dynamicfake.FakeDynamicClient, gvr schema.GroupVersionResource) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		applied := &unstructured.Unstructured{}
+		if err := applied.UnmarshalJSON(patch.GetPatch()); err != nil {
+			return true, nil, err
+		}
+
+		obj, err := client.Tracker().Get(gvr, patch.GetNamespace(), patch.GetName())
+		if apierrors.IsNotFound(err) {
+			applied.SetResourceVersion("1")
+			return true, applied, client.Tracker().Create(gvr, applied, patch.GetNamespace())
+		}
+		if err != nil {
+			return true, nil, err
+		}
+
+		current := obj.(*unstructured.Unstructured)
+		merged := current.DeepCopy()
+		for k, v := range applied.Object {
+			if k != "metadata" {
+				merged.Object[k] = v
+			}
+		}
+		if equality.Semantic.DeepEqual(current, merged) {
+			return true, current, nil
+		}
+		rv, _ := strconv.Atoi(current.GetResourceVersion())
+		merged.SetResourceVersion(strconv.Itoa(rv + 1))
+		return true, merged, client.Tracker().Update(gvr, merged, patch.GetNamespace())
+	}
+}
+
+func TestApplyUnstructuredServerSideUnchanged(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "WidgetList"})
+	client.PrependReactor("patch", "widgets", serverSideApplyReactor(client, gvr))
+	o := NewApplyOptions(client, nil).WithServerSide(true)
+	mapper := testRESTMapper()
+
+	result, err := o.ApplyUnstructured(context.TODO(), mapper, testWidget(map[string]interface{}{"foo": "bar"}))
+	assert.Nil(t, err)
+	assert.Equal(t, OperationCreated, result.Operation)
+
+	result, err = o.ApplyUnstructured(context.TODO(), mapper, testWidget(map[string]interface{}{"foo": "bar"}))
+	assert.Nil(t, err)
+	assert.Equal(t, OperationUnchanged, result.Operation)
+	assert.Equal(t, "1", result.Object.GetResourceVersion())
+
+	result, err = o.ApplyUnstructured(context.TODO(), mapper, testWidget(map[string]interface{}{"foo": "baz"}))
+	assert.Nil(t, err)
+	assert.Equal(t, OperationConfigured, result.Operation)
+	assert.Equal(t, "2", result.Object.GetResourceVersion())
+}
+
+func TestRedact(t *testing.T) {
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name": "demo",
+			"annotations": map[string]interface{}{
+				corev1.LastAppliedConfigAnnotation: `{"data":{"password":"cGFzc3dvcmQ="}}`,
+			},
+		},
+		"data":       map[string]interface{}{"password": "cGFzc3dvcmQ="},
+		"stringData": map[string]interface{}{"token": "token"},
+	}}
+
+	redacted := Redact(secret)
+	assert.Equal(t, RedactedValue, redacted.Object["data"].(map[string]interface{})["password"])
+	assert.Equal(t, RedactedValue, redacted.Object["stringData"].(map[string]interface{})["token"])
+	assert.Equal(t, RedactedValue, redacted.GetAnnotations()[corev1.LastAppliedConfigAnnotation])
+	// the original object is not changed
+	assert.Equal(t, "cGFzc3dvcmQ=", secret.Object["data"].(map[string]interface{})["password"])
+
+	widget := testWidget(map[string]interface{}{"foo": "bar"})
+	assert.Equal(t, &widget, Redact(&widget))
+}
+
+func TestApplyUnstructuredSecretServerSide(t *testing.T) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, meta.RESTScopeNamespace)
+	secret := func(password string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata": map[string]interface{}{
+				"name":      "demo",
+				"namespace": "default",
+				"annotations": map[string]interface{}{
+					corev1.LastAppliedConfigAnnotation: fmt.Sprintf(`{"data":{"password":%q}}`, password),
+				},
+			},
+			"data": map[string]interface{}{"password": password},
+		}}
+	}
+
+	// the secret was applied by the client-side apply before
+	existing := secret("b2xk")
+	existing.SetResourceVersion("1")
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "SecretList"}, existing)
+	client.PrependReactor("patch", "secrets", serverSideApplyReactor(client, gvr))
+
+	result, err := NewApplyOptions(client, nil).WithSecretServerSide(true).ApplyUnstructured(context.TODO(), mapper, *secret("bmV3"))
+	assert.Nil(t, err)
+	assert.Equal(t, OperationConfigured, result.Operation)
+
+	actions := client.Actions()
+	assert.Equal(t, 3, len(actions))
+	removal := actions[1].(k8stesting.PatchAction)
+	assert.Equal(t, types.MergePatchType, removal.GetPatchType())
+	apply := actions[2].(k8stesting.PatchAction)
+	assert.Equal(t, types.ApplyPatchType, apply.GetPatchType())
+	assert.NotContains(t, string(apply.GetPatch()), corev1.LastAppliedConfigAnnotation)
+
+	obj, err := client.Tracker().Get(gvr, "default", "demo")
+	assert.Nil(t, err)
+	stored := obj.(*unstructured.Unstructured)
+	_, ok := stored.GetAnnotations()[corev1.LastAppliedConfigAnnotation]
+	assert.False(t, ok)
+	assert.Equal(t, "bmV3", stored.Object["data"].(map[string]interface{})["password"])
+}
+
+func TestApplyUnstructuredCreateOrSkip(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "WidgetList"})
+	o := NewApplyOptions(client, nil)
+	mapper := testRESTMapper()
+
+	seed := func(value string) unstructured.Unstructured {
+		obj := testWidget(map[string]interface{}{"foo": value})
+		obj.SetAnnotations(map[string]string{ApplyModeAnnotation: ApplyModeCreateOrSkip})
+		return obj
+	}
+
+	result, err := o.ApplyUnstructured(context.TODO(), mapper, seed("bar"))
+	assert.Nil(t, err)
+	assert.Equal(t, OperationCreated, result.Operation)
+	_, ok := result.Object.GetAnnotations()[corev1.LastAppliedConfigAnnotation]
+	assert.False(t, ok)
+
+	result, err = o.ApplyUnstructured(context.TODO(), mapper, seed("baz"))
+	assert.Nil(t, err)
+	assert.Equal(t, OperationSkipped, result.Operation)
+	assert.Equal(t, "bar", result.Object.Object["spec"].(map[string]interface{})["foo"])
+
+	createOnly := testWidget(map[string]interface{}{"foo": "bar"})
+	createOnly.SetAnnotations(map[string]string{ApplyModeAnnotation: ApplyModeCreateOnly})
+	_, err = o.ApplyUnstructured(context.TODO(), mapper, createOnly)
+	assert.NotNil(t, err)
+
+	generate := testWidget(map[string]interface{}{"foo": "bar"})
+	generate.SetName("")
+	generate.SetGenerateName("demo-")
+	_, err = o.ApplyUnstructured(context.TODO(), mapper, generate)
+	assert.NotNil(t, err)
+}
+
+func TestApplyUnstructuredGenerate(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "WidgetList"})
+	// the fake client doesn't generate the name like the apiserver
+	generated := 0
+	client.PrependReactor("create", "widgets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		if obj.GetName() == "" {
+			generated++
+			obj.SetName(fmt.Sprintf("%s%d", obj.GetGenerateName(), generated))
+		}
+		return false, nil, nil
+	})
+	o := NewApplyOptions(client, nil)
+	mapper := testRESTMapper()
+
+	job := func() unstructured.Unstructured {
+		obj := testWidget(map[string]interface{}{"foo": "bar"})
+		obj.SetName("ignored")
+		obj.SetGenerateName("demo-")
+		obj.SetAnnotations(map[string]string{ApplyModeAnnotation: ApplyModeGenerate})
+		return obj
+	}
+	seed := func() unstructured.Unstructured {
+		obj := testWidget(map[string]interface{}{"foo": "bar"})
+		obj.SetName("seed")
+		obj.SetAnnotations(map[string]string{ApplyModeAnnotation: ApplyModeCreateOrSkip})
+		return obj
+	}
+
+	// the first run creates both objects
+	result, err := o.ApplyUnstructured(context.TODO(), mapper, job())
+	assert.Nil(t, err)
+	assert.Equal(t, OperationCreated, result.Operation)
+	assert.Equal(t, "demo-1", result.Name)
+	create := client.Actions()[0].(k8stesting.CreateAction)
+	assert.Equal(t, "demo-", create.GetObject().(*unstructured.Unstructured).GetGenerateName())
+
+	result, err = o.ApplyUnstructured(context.TODO(), mapper, seed())
+	assert.Nil(t, err)
+	assert.Equal(t, OperationCreated, result.Operation)
+
+	// the second run creates a new object with the generate name, and skips the existing seed
+	client.ClearActions()
+	result, err = o.ApplyUnstructured(context.TODO(), mapper, job())
+	assert.Nil(t, err)
+	assert.Equal(t, OperationCreated, result.Operation)
+	assert.Equal(t, "demo-2", result.Name)
+
+	result, err = o.ApplyUnstructured(context.TODO(), mapper, seed())
+	assert.Nil(t, err)
+	assert.Equal(t, OperationSkipped, result.Operation)
+	for _, action := range client.Actions()[1:] {
+		assert.Equal(t, "get", action.GetVerb())
+	}
+
+	noGenerateName := job()
+	noGenerateName.SetGenerateName("")
+	_, err = o.ApplyUnstructured(context.TODO(), mapper, noGenerateName)
+	assert.NotNil(t, err)
+}
+
+func TestApplyUnstructuredStatus(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "WidgetList"})
+	mapper := testRESTMapper()
+
+	_, err := NewApplyOptions(client, nil).WithSubresource(SubresourceStatus).ApplyUnstructured(context.TODO(), mapper, testWidget(nil))
+	assert.NotNil(t, err)
+
+	_, err = NewApplyOptions(client, nil).ApplyUnstructured(context.TODO(), mapper, testWidget(map[string]interface{}{"foo": "bar"}))
+	assert.Nil(t, err)
+
+	obj := testWidget(map[string]interface{}{"foo": "baz"})
+	obj.Object["status"] = map[string]interface{}{"phase": "Ready"}
+	client.ClearActions()
+	result, err := NewApplyOptions(client, nil).WithSubresource(SubresourceStatus).ApplyUnstructured(context.TODO(), mapper, obj)
+	assert.Nil(t, err)
+	assert.Equal(t, SubresourceStatus, result.Subresource)
+	assert.Equal(t, "Widget", result.GroupVersionKind.Kind)
+
+	patch := client.Actions()[1].(k8stesting.PatchAction)
+	assert.Equal(t, SubresourceStatus, patch.GetSubresource())
+	assert.Equal(t, types.MergePatchType, patch.GetPatchType())
+	assert.JSONEq(t, `{"status":{"phase":"Ready"}}`, string(patch.GetPatch()))
+}
+
+func TestApplyUnstructuredServerSideStatus(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	existing := testWidget(map[string]interface{}{"foo": "bar"})
+	existing.SetResourceVersion("1")
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "WidgetList"}, &existing)
+	// the fake client doesn't support server-side apply
+	client.PrependReactor("patch", "widgets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patched := existing.DeepCopy()
+		patched.SetResourceVersion("2")
+		patched.Object["status"] = map[string]interface{}{"phase": "Ready"}
+		return true, patched, nil
+	})
+
+	obj := testWidget(map[string]interface{}{"foo": "baz"})
+	obj.Object["status"] = map[string]interface{}{"phase": "Ready"}
+	result, err := NewApplyOptions(client, nil).WithServerSide(true).WithSubresource(SubresourceStatus).ApplyUnstructured(context.TODO(), testRESTMapper(), obj)
+	assert.Nil(t, err)
+	assert.Equal(t, OperationConfigured, result.Operation)
+	assert.Equal(t, SubresourceStatus, result.Subresource)
+
+	patch := client.Actions()[1].(k8stesting.PatchAction)
+	assert.Equal(t, SubresourceStatus, patch.GetSubresource())
+	assert.Equal(t, types.ApplyPatchType, patch.GetPatchType())
+	assert.JSONEq(t, `{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"demo","namespace":"default"},"status":{"phase":"Ready"}}`, string(patch.GetPatch()))
+}
+
+func TestApplyUnstructuredScale(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+
+	deployment := func(replicas int64) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":            "demo",
+				"namespace":       "default",
+				"resourceVersion": "1",
+			},
+			"spec": map[string]interface{}{"replicas": replicas},
+		}}
+	}
+
+	for _, serverSide := range []bool{false, true} {
+		client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "DeploymentList"}, deployment(1))
+		// the fake client ignores the subresource, the server returns the Scale object
+		client.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "autoscaling/v1",
+				"kind":       "Scale",
+				"metadata": map[string]interface{}{
+					"name":            "demo",
+					"namespace":       "default",
+					"resourceVersion": "2",
+				},
+				"spec": map[string]interface{}{"replicas": int64(3)},
+			}}, nil
+		})
+
+		result, err := NewApplyOptions(client, nil).WithServerSide(serverSide).WithSubresource(SubresourceScale).ApplyUnstructured(context.TODO(), mapper, *deployment(3))
+		assert.Nil(t, err)
+		assert.Equal(t, OperationConfigured, result.Operation)
+		assert.Equal(t, SubresourceScale, result.Subresource)
+		assert.Equal(t, "Deployment", result.GroupVersionKind.Kind)
+		assert.Equal(t, "Scale", result.Object.GetKind())
+
+		patch := client.Actions()[1].(k8stesting.PatchAction)
+		assert.Equal(t, SubresourceScale, patch.GetSubresource())
+		if serverSide {
+			assert.Equal(t, types.ApplyPatchType, patch.GetPatchType())
+			assert.JSONEq(t, `{"apiVersion":"autoscaling/v1","kind":"Scale","metadata":{"name":"demo","namespace":"default"},"spec":{"replicas":3}}`, string(patch.GetPatch()))
+		} else {
+			assert.Equal(t, types.MergePatchType, patch.GetPatchType())
+			assert.JSONEq(t, `{"spec":{"replicas":3}}`, string(patch.GetPatch()))
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+)
+
+const (
+	DefaultClusterConcurrency = 5
+	DefaultCanaryReadyTimeout = 5 * time.Minute
+)
+
+// ClusterClients holds the clients used to apply resources to a cluster.
+type ClusterClients struct {
+	DynamicClient   dynamic.Interface
+	DiscoveryClient discovery.DiscoveryInterface
+}
+
+// ClusterResult is the apply result of a cluster.
+type ClusterResult struct {
+	Cluster string   `json:"cluster"`
+	Results []Result `json:"results"`
+	// Skipped is true if the cluster is not applied, because the canary cluster failed.
+	Skipped bool  `json:"skipped,omitempty"`
+	Err     error `json:"-"`
+	// Error is the message of the Err, it's kept when the result is serialized.
+	Error string `json:"error,omitempty"`
+}
+
+// Summary is the aggregate result of all clusters.
+type Summary struct {
+	Clusters   int `json:"clusters"`
+	Succeeded  int `json:"succeeded"`
+	Failed     int `json:"failed"`
+	Skipped    int `json:"skipped"`
+	Created    int `json:"created"`
+	Configured int `json:"configured"`
+	Unchanged  int `json:"unchanged"`
+	// SkippedObjects is the number of existing objects skipped by the create-or-skip apply mode.
+	SkippedObjects int `json:"skippedObjects"`
+}
+
+type multiClusterApplyOptions struct {
+	clusters         map[string]ClusterClients
+	concurrency      int
+	serverSide       bool
+	secretServerSide bool
+	// canary is the cluster applied first, the other clusters are applied after its objects are ready.
+	canary             string
+	canaryReadyTimeout time.Duration
+}
+
+// NewMultiClusterApplyOptions returns the options to apply the same resources to multiple clusters,
+// the key of the clusters is the cluster name.
+func NewMultiClusterApplyOptions(clusters map[string]ClusterClients) *multiClusterApplyOptions {
+	return &multiClusterApplyOptions{
+		clusters:           clusters,
+		concurrency:        DefaultClusterConcurrency,
+		canaryReadyTimeout: DefaultCanaryReadyTimeout,
+	}
+}
+
+// WithConcurrency sets the number of clusters applied at the same time.
+func (o *multiClusterApplyOptions) WithConcurrency(concurrency int) *multiClusterApplyOptions {
+	if concurrency > 0 {
+		o.concurrency = concurrency
+	}
+	return o
+}
+
+func (o *multiClusterApplyOptions) WithServerSide(serverSide bool) *multiClusterApplyOptions {
+	o.serverSide = serverSide
+	return o
+}
+
+func (o *multiClusterApplyOptions) WithSecretServerSide(secretServerSide bool) *multiClusterApplyOptions {
+	o.secretServerSide = secretServerSide
+	return o
+}
+
+// WithCanary applies to the canary cluster first and waits its objects ready within the timeout,
+// the other clusters are applied only when the canary cluster succeeded.
+func (o *multiClusterApplyOptions) WithCanary(cluster string, timeout time.Duration) *multiClusterApplyOptions {
+	o.canary = cluster
+	if timeout > 0 {
+		o.canaryReadyTimeout = timeout
+	}
+	return o
+}
+
+func (o *multiClusterApplyOptions) applyOptionsFor(c ClusterClients) *applyOptions {
+	return NewApplyOptions(c.DynamicClient, c.DiscoveryClient).
+		WithServerSide(o.serverSide).
+		WithSecretServerSide(o.secretServerSide)
+}
+
+// Apply applies data to all clusters, and returns the result of each cluster and the summary.
+// The returned error aggregates the errors of all failed clusters.
+func (o *multiClusterApplyOptions) Apply(ctx context.Context, data []byte) (map[string]*ClusterResult, Summary, error) {
+	results := make(map[string]*ClusterResult, len(o.clusters))
+
+	names := make([]string, 0, len(o.clusters))
+	for name := range o.clusters {
+		if name == o.canary {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if o.canary != "" {
+		c, ok := o.clusters[o.canary]
+		if !ok {
+			return nil, Summary{}, fmt.Errorf("canary cluster %s not found", o.canary)
+		}
+
+		result := o.applyCluster(ctx, o.canary, c, data, true).setError()
+		results[o.canary] = result
+		if result.Err != nil {
+			klog.Errorf("Canary cluster %s failed, skip the other clusters: %v", o.canary, result.Err)
+			for _, name := range names {
+				results[name] = &ClusterResult{Cluster: name, Skipped: true}
+			}
+			return results, summarize(results), aggregateErrors(results)
+		}
+	}
+
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+	)
+	sem := make(chan struct{}, o.concurrency)
+	for _, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(name string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			result := o.applyCluster(ctx, name, o.clusters[name], data, false).setError()
+			lock.Lock()
+			results[name] = result
+			lock.Unlock()
+		}(name)
+	}
+	wg.Wait()
+
+	return results, summarize(results), aggregateErrors(results)
+}
+
+func (o *multiClusterApplyOptions) applyCluster(ctx context.Context, name string, c ClusterClients, data []byte, waitReady bool) *ClusterResult {
+	klog.V(2).Infof("Apply to cluster %s", name)
+	opts := o.applyOptionsFor(c)
+	result := &ClusterResult{Cluster: name}
+
+	result.Results, result.Err = opts.ApplyWithResults(ctx, data)
+	if result.Err != nil || !waitReady {
+		return result
+	}
+
+	restMapper, err := opts.ToRESTMapper()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Err = opts.WaitForReady(ctx, restMapper, result.Results, o.canaryReadyTimeout)
+	return result
+}
+
+// setError sets the error message of the result.
+func (r *ClusterResult) setError() *ClusterResult {
+	if r.Err != nil {
+		r.Error = r.Err.Error()
+	}
+	return r
+}
+
+func summarize(results map[string]*ClusterResult) Summary {
+	summary := Summary{Clusters: len(results)}
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			summary.Skipped++
+		case r.Err != nil:
+			summary.Failed++
+		default:
+			summary.Succeeded++
+		}
+
+		for _, o := range r.Results {
+			switch o.Operation {
+			case OperationCreated:
+				summary.Created++
+			case OperationConfigured:
+				summary.Configured++
+			case OperationUnchanged:
+				summary.Unchanged++
+			case OperationSkipped:
+				summary.SkippedObjects++
+			}
+		}
+	}
+	return summary
+}
+
+func aggregateErrors(results map[string]*ClusterResult) error {
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := results[name].Err; err != nil {
+			errs = append(errs, fmt.Errorf("cluster %s: %v", name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
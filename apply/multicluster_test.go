@@ -0,0 +1,212 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testWidgetYAML = `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: demo
+  namespace: default
+spec:
+  foo: bar
+`
+
+var (
+	widgetGVR     = schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	deploymentGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+)
+
+// testCluster returns the fake clients of a cluster which serves the widgets and deployments,
+// the reactor is called before the object tracker.
+func testCluster(reactor k8stesting.ReactionFunc, objects ...runtime.Object) ClusterClients {
+	dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		widgetGVR:     "WidgetList",
+		deploymentGVR: "DeploymentList",
+	}, objects...)
+	if reactor != nil {
+		dc.PrependReactor("*", "*", reactor)
+	}
+
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: []*metav1.APIResourceList{
+		{
+			GroupVersion: "example.com/v1",
+			APIResources: []metav1.APIResource{{Name: "widgets", Kind: "Widget", Namespaced: true}},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{{Name: "deployments", Kind: "Deployment", Namespaced: true}},
+		},
+	}}}
+	return ClusterClients{DynamicClient: dc, DiscoveryClient: discoveryClient}
+}
+
+func testDeployment(name string, ready bool) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":       name,
+			"namespace":  "default",
+			"generation": int64(1),
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+		},
+	}}
+	if ready {
+		obj.Object["status"] = map[string]interface{}{
+			"observedGeneration": int64(1),
+			"replicas":           int64(2),
+			"updatedReplicas":    int64(2),
+			"availableReplicas":  int64(2),
+		}
+	}
+	return obj
+}
+
+func TestMultiClusterApplyConcurrency(t *testing.T) {
+	var inflight, maxInflight int32
+	reactor := func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetVerb() != "create" {
+			return false, nil, nil
+		}
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInflight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInflight, max, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		return false, nil, nil
+	}
+
+	clusters := make(map[string]ClusterClients)
+	for i := 0; i < 6; i++ {
+		clusters[fmt.Sprintf("cluster-%d", i)] = testCluster(reactor)
+	}
+
+	results, summary, err := NewMultiClusterApplyOptions(clusters).WithConcurrency(2).Apply(context.TODO(), []byte(testWidgetYAML))
+	assert.Nil(t, err)
+	assert.Len(t, results, 6)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxInflight))
+	assert.Equal(t, Summary{Clusters: 6, Succeeded: 6, Created: 6}, summary)
+}
+
+func TestMultiClusterApplyCanary(t *testing.T) {
+	failed := func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetVerb() == "create" {
+			return true, nil, fmt.Errorf("quota exceeded")
+		}
+		return false, nil, nil
+	}
+
+	t.Run("canary failed", func(t *testing.T) {
+		clusters := map[string]ClusterClients{
+			"canary": testCluster(failed),
+			"a":      testCluster(nil),
+			"b":      testCluster(nil),
+		}
+		results, summary, err := NewMultiClusterApplyOptions(clusters).WithCanary("canary", time.Second).Apply(context.TODO(), []byte(testWidgetYAML))
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "cluster canary")
+		assert.Contains(t, results["canary"].Error, "quota exceeded")
+		assert.True(t, results["a"].Skipped)
+		assert.True(t, results["b"].Skipped)
+		assert.Empty(t, clusters["a"].DynamicClient.(*dynamicfake.FakeDynamicClient).Actions())
+		assert.Equal(t, Summary{Clusters: 3, Failed: 1, Skipped: 2}, summary)
+	})
+
+	t.Run("canary succeeded", func(t *testing.T) {
+		clusters := map[string]ClusterClients{
+			"canary": testCluster(nil),
+			"a":      testCluster(nil),
+			"b":      testCluster(failed),
+		}
+		results, summary, err := NewMultiClusterApplyOptions(clusters).WithCanary("canary", time.Second).Apply(context.TODO(), []byte(testWidgetYAML))
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "cluster b")
+		assert.Empty(t, results["canary"].Error)
+		assert.False(t, results["a"].Skipped)
+		assert.Equal(t, OperationCreated, results["a"].Results[0].Operation)
+		assert.Equal(t, Summary{Clusters: 3, Succeeded: 2, Failed: 1, Created: 2}, summary)
+	})
+
+	t.Run("canary not found", func(t *testing.T) {
+		_, _, err := NewMultiClusterApplyOptions(map[string]ClusterClients{"a": testCluster(nil)}).WithCanary("canary", time.Second).Apply(context.TODO(), []byte(testWidgetYAML))
+		assert.NotNil(t, err)
+	})
+}
+
+func TestWaitForReady(t *testing.T) {
+	defer func(interval time.Duration) { readyPollInterval = interval }(readyPollInterval)
+	readyPollInterval = 10 * time.Millisecond
+
+	results := func(names ...string) []Result {
+		var rs []Result
+		for _, name := range names {
+			rs = append(rs, Result{
+				GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+				Namespace:        "default",
+				Name:             name,
+			})
+		}
+		return rs
+	}
+
+	// the slow-1 becomes ready after the readyAt
+	var readyAt atomic.Value
+	readyAt.Store(time.Time{})
+	reactor := func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get, ok := action.(k8stesting.GetAction)
+		if !ok || get.GetName() != "slow-1" {
+			return false, nil, nil
+		}
+		at := readyAt.Load().(time.Time)
+		return !at.IsZero() && time.Now().After(at), testDeployment("slow-1", true), nil
+	}
+
+	c := testCluster(reactor, testDeployment("ready", true), testDeployment("slow-1", false), testDeployment("slow-2", false))
+	o := NewApplyOptions(c.DynamicClient, c.DiscoveryClient)
+	mapper, err := o.ToRESTMapper()
+	assert.Nil(t, err)
+
+	t.Run("ready", func(t *testing.T) {
+		assert.Nil(t, o.WaitForReady(context.TODO(), mapper, results("ready"), time.Second))
+	})
+
+	t.Run("the timeout is shared by all objects", func(t *testing.T) {
+		start := time.Now()
+		readyAt.Store(start.Add(300 * time.Millisecond))
+		err := o.WaitForReady(context.TODO(), mapper, results("slow-1", "slow-2"), 500*time.Millisecond)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "slow-2")
+		assert.Contains(t, err.Error(), "timed out")
+		// waiting the full timeout for each object would take 800ms
+		assert.Less(t, int64(time.Since(start)), int64(700*time.Millisecond))
+	})
+
+	t.Run("ctx cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		err := o.WaitForReady(ctx, mapper, results("slow-2"), time.Minute)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), context.Canceled.Error())
+	})
+}
@@ -0,0 +1,105 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// IsReady returns true if the object rollout is complete. Only the apps Deployment, StatefulSet
+// and DaemonSet are checked, other objects are ready once they are applied.
+func IsReady(obj *unstructured.Unstructured) (bool, error) {
+	if obj.GroupVersionKind().Group != "apps" {
+		return true, nil
+	}
+
+	observedGeneration, _, err := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if err != nil {
+		return false, err
+	}
+	if observedGeneration < obj.GetGeneration() {
+		return false, nil
+	}
+
+	switch obj.GetKind() {
+	case "Deployment", "StatefulSet":
+		replicas, found, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			replicas = 1
+		}
+		status, err := nestedInt64s(obj, "status", "replicas", "updatedReplicas", "availableReplicas", "readyReplicas")
+		if err != nil {
+			return false, err
+		}
+		if obj.GetKind() == "Deployment" {
+			return status["updatedReplicas"] == replicas && status["replicas"] == replicas && status["availableReplicas"] == replicas, nil
+		}
+		return status["updatedReplicas"] == replicas && status["readyReplicas"] == replicas, nil
+	case "DaemonSet":
+		status, err := nestedInt64s(obj, "status", "desiredNumberScheduled", "updatedNumberScheduled", "numberAvailable")
+		if err != nil {
+			return false, err
+		}
+		return status["updatedNumberScheduled"] == status["desiredNumberScheduled"] && status["numberAvailable"] == status["desiredNumberScheduled"], nil
+	}
+	return true, nil
+}
+
+// nestedInt64s returns the int64 values of the fields under the path, the missing field is zero.
+func nestedInt64s(obj *unstructured.Unstructured, path string, fields ...string) (map[string]int64, error) {
+	values := make(map[string]int64, len(fields))
+	for _, f := range fields {
+		v, _, err := unstructured.NestedInt64(obj.Object, path, f)
+		if err != nil {
+			return nil, err
+		}
+		values[f] = v
+	}
+	return values, nil
+}
+
+// readyPollInterval is the interval of checking the objects ready.
+var readyPollInterval = time.Second
+
+// WaitForReady waits until all applied objects are ready, or returns error when the timeout
+// is reached or the ctx is done. The timeout is shared by all objects.
+func (o *applyOptions) WaitForReady(ctx context.Context, restMapper meta.RESTMapper, results []Result, timeout time.Duration) error {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for _, r := range results {
+		mapping, err := restMapper.RESTMapping(r.GroupVersionKind.GroupKind(), r.GroupVersionKind.Version)
+		if err != nil {
+			return err
+		}
+
+		dri := o.dynamicClient.Resource(mapping.Resource).Namespace(r.Namespace)
+		err = wait.PollImmediateUntilWithContext(waitCtx, readyPollInterval, func(ctx context.Context) (bool, error) {
+			obj, err := dri.Get(ctx, r.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return IsReady(obj)
+		})
+		if err != nil {
+			switch {
+			case ctx.Err() != nil:
+				err = ctx.Err()
+			case waitCtx.Err() == context.DeadlineExceeded:
+				err = fmt.Errorf("timed out after %s", timeout)
+			}
+			return fmt.Errorf("waiting for %s %s/%s ready: %v", r.GroupVersionKind.Kind, r.Namespace, r.Name, err)
+		}
+		klog.V(2).Infof("%s %s/%s is ready", r.GroupVersionKind.Kind, r.Namespace, r.Name)
+	}
+	return nil
+}
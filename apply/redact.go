@@ -0,0 +1,42 @@
+package apply
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RedactedValue replaces the Secret payload when the object is logged.
+const RedactedValue = "<redacted>"
+
+// isSecret returns true if the object is a core/v1 Secret.
+func isSecret(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	return gvk.Group == corev1.GroupName && gvk.Kind == "Secret"
+}
+
+// Redact returns a copy of the object which is safe to log. The values of the Secret `data`,
+// `stringData` and the last-applied-configuration annotation are replaced with RedactedValue,
+// other objects are returned without any change.
+func Redact(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	if obj == nil || !isSecret(obj) {
+		return obj
+	}
+
+	redacted := obj.DeepCopy()
+	for _, field := range []string{"data", "stringData"} {
+		m, ok := redacted.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for k := range m {
+			m[k] = RedactedValue
+		}
+	}
+
+	annotations := redacted.GetAnnotations()
+	if _, ok := annotations[corev1.LastAppliedConfigAnnotation]; ok {
+		annotations[corev1.LastAppliedConfigAnnotation] = RedactedValue
+		redacted.SetAnnotations(annotations)
+	}
+	return redacted
+}
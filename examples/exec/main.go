@@ -42,12 +42,11 @@ func handler(w http.ResponseWriter, r *http.Request) {
 	}
 	containerName := containers[0]
 
-	commands, ok := urlValues["shell"]
-	if !ok || len(containers) < 1 {
-		w.WriteHeader(http.StatusBadRequest)
-		return
+	// detect the shell if the shell is not set
+	var cmd []string
+	if commands, ok := urlValues["shell"]; ok && len(commands) > 0 {
+		cmd = []string{commands[0]}
 	}
-	cmd := commands[0]
 
 	ts, err := terminal.NewTerminalSession(client, w, r, nil)
 	if err != nil {
@@ -56,11 +55,15 @@ func handler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer ts.Close()
 
-	if err := ts.Exec(config, namespace, podName, containerName, []string{cmd}, &terminal.ExecOptions{
+	if err := ts.Exec(r.Context(), config, namespace, podName, containerName, cmd, &terminal.ExecOptions{
 		Stdin:  true,
 		Stdout: true,
 		Stderr: true,
 		TTY:    true,
+		Shells: terminal.DefaultShells,
+		ShellChosen: func(shell string) {
+			log.Printf("exec shell %s in container %s/%s/%s", shell, namespace, podName, containerName)
+		},
 	}); err != nil {
 		log.Printf("unable to execute stream in container, %v", err)
 		ts.Done()
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"path/filepath"
@@ -43,8 +44,11 @@ func main() {
 		panic(err.Error())
 	}
 
-	viewer := history.ViewerFor(client, schema.GroupKind{Group: "apps", Kind: kind})
-	latest, olds, err := viewer.ViewHistory(namespace, name)
+	viewer, err := history.ViewerFor(client, schema.GroupKind{Group: "apps", Kind: kind})
+	if err != nil {
+		panic(err.Error())
+	}
+	latest, olds, err := viewer.ViewHistory(context.TODO(), namespace, name)
 	if err != nil {
 		panic(err.Error())
 	}
@@ -0,0 +1,218 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pytimer/k8sutil/podutil"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// listControllerRevisions returns the ControllerRevisions owned by the owner, sorted by revision.
+func listControllerRevisions(ctx context.Context, c kubernetes.Interface, namespace string, selector *metav1.LabelSelector, owner metav1.Object, pageSize int64) ([]*appsv1.ControllerRevision, error) {
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	options := metav1.ListOptions{LabelSelector: labelSelector.String()}
+	listFunc := func(opts metav1.ListOptions) (runtime.Object, error) {
+		return c.AppsV1().ControllerRevisions(namespace).List(ctx, opts)
+	}
+
+	owned := make([]*appsv1.ControllerRevision, 0)
+	err = eachListItem(ctx, pageSize, options, listFunc, func(obj runtime.Object) {
+		if cr, ok := obj.(*appsv1.ControllerRevision); ok && metav1.IsControlledBy(cr, owner) {
+			owned = append(owned, cr)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(controllerRevisionsByRevision(owned))
+
+	return owned, nil
+}
+
+// listPods returns the pods owned by the owner.
+func listPods(ctx context.Context, c kubernetes.Interface, namespace string, selector *metav1.LabelSelector, owner metav1.Object, pageSize int64) ([]*corev1.Pod, error) {
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	options := metav1.ListOptions{LabelSelector: labelSelector.String()}
+	listFunc := func(opts metav1.ListOptions) (runtime.Object, error) {
+		return c.CoreV1().Pods(namespace).List(ctx, opts)
+	}
+
+	owned := make([]*corev1.Pod, 0)
+	err = eachListItem(ctx, pageSize, options, listFunc, func(obj runtime.Object) {
+		if pod, ok := obj.(*corev1.Pod); ok && metav1.IsControlledBy(pod, owner) {
+			owned = append(owned, pod)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return owned, nil
+}
+
+// controllerRevisionTemplate decodes the pod template from the ControllerRevision data,
+// the StatefulSet and DaemonSet save the patch of spec.template in the data.
+func controllerRevisionTemplate(cr *appsv1.ControllerRevision) (*corev1.PodTemplateSpec, error) {
+	raw := cr.Data.Raw
+	if len(raw) == 0 && cr.Data.Object != nil {
+		var err error
+		if raw, err = json.Marshal(cr.Data.Object); err != nil {
+			return nil, err
+		}
+	}
+
+	var patch struct {
+		Spec struct {
+			Template corev1.PodTemplateSpec `json:"template"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return nil, fmt.Errorf("decode ControllerRevision %s data error, %v", cr.Name, err)
+	}
+	return &patch.Spec.Template, nil
+}
+
+// isRevisionPod returns true if the pod belongs to the ControllerRevision. The controller-revision-hash
+// label of the StatefulSet pod is the ControllerRevision name, and the DaemonSet pod is the hash.
+func isRevisionPod(cr *appsv1.ControllerRevision, pod *corev1.Pod) bool {
+	v, ok := pod.Labels[appsv1.ControllerRevisionHashLabelKey]
+	if !ok {
+		return false
+	}
+	hash := cr.Labels[appsv1.ControllerRevisionHashLabelKey]
+	return v == cr.Name || (hash != "" && v == hash)
+}
+
+// revisionPodsStatus counts the pods of the ControllerRevision.
+func revisionPodsStatus(cr *appsv1.ControllerRevision, pods []*corev1.Pod, minReadySeconds int32) HistoryStatus {
+	now := metav1.Now()
+	status := HistoryStatus{}
+	for _, pod := range pods {
+		if !isRevisionPod(cr, pod) || pod.DeletionTimestamp != nil {
+			continue
+		}
+		status.DesiredReplicas++
+		if podutil.IsPodReady(*pod) {
+			status.ReadyReplicas++
+		}
+		if podutil.IsPodAvailable(pod, minReadySeconds, now) {
+			status.AvailableReplicas++
+		}
+	}
+	return status
+}
+
+func controllerRevisionsToRevisionHistory(revisions []*appsv1.ControllerRevision, pods []*corev1.Pod, minReadySeconds int32) []*RevisionHistory {
+	rhs := make([]*RevisionHistory, 0, len(revisions))
+	for _, cr := range revisions {
+		rh, err := singleControllerRevisionToRevisionHistory(cr, pods, minReadySeconds)
+		if err != nil {
+			klog.Warningf("ControllerRevision %s to revision history fail, %v", cr.Name, err)
+			continue
+		}
+		rhs = append(rhs, &rh)
+	}
+	return rhs
+}
+
+func singleControllerRevisionToRevisionHistory(cr *appsv1.ControllerRevision, pods []*corev1.Pod, minReadySeconds int32) (RevisionHistory, error) {
+	template, err := controllerRevisionTemplate(cr)
+	if err != nil {
+		return RevisionHistory{}, err
+	}
+
+	return RevisionHistory{
+		Revision:        cr.Revision,
+		Name:            cr.Name,
+		Labels:          cr.Labels,
+		Annotations:     cr.Annotations,
+		CreateTimestamp: cr.CreationTimestamp,
+		Status:          revisionPodsStatus(cr, pods, minReadySeconds),
+		Images:          templateImages(template),
+		Template:        *template,
+		ChangeCause:     cr.Annotations[ChangeCauseAnnotation],
+	}, nil
+}
+
+// diffControllerRevisions diffs the pod templates of the two revisions.
+func diffControllerRevisions(revisions []*appsv1.ControllerRevision, from, to int64) (*RevisionDiff, error) {
+	templates := make([]*corev1.PodTemplateSpec, 0, 2)
+	for _, revision := range []int64{from, to} {
+		cr, err := findControllerRevision(revisions, revision)
+		if err != nil {
+			return nil, err
+		}
+		template, err := controllerRevisionTemplate(cr)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return DiffTemplates(templates[0], templates[1], from, to)
+}
+
+// controllerRevisionHistory returns the update revision as the latest revision, and the others as the old revisions.
+// If the updateRevision is empty, the newest revision is the latest revision.
+func controllerRevisionHistory(revisions []*appsv1.ControllerRevision, pods []*corev1.Pod, minReadySeconds int32,
+	currentRevision, updateRevision string, revisionHistoryLimit *int32) ([]*RevisionHistory, []*RevisionHistory) {
+	rhs := controllerRevisionsToRevisionHistory(revisions, pods, minReadySeconds)
+	for _, rh := range rhs {
+		rh.CurrentRevision = rh.Name == currentRevision
+		rh.UpdateRevision = rh.Name == updateRevision
+	}
+
+	if updateRevision == "" && len(rhs) > 0 {
+		// the controller has not observed the workload, use the newest revision
+		updateRevision = rhs[len(rhs)-1].Name
+	}
+
+	latest, olds := splitRevisionHistory(rhs, updateRevision)
+	setHistoryPositions(latest, olds, revisionHistoryLimit)
+	return latest, olds
+}
+
+// splitRevisionHistory returns the revision history which name is latest, and the others.
+func splitRevisionHistory(rhs []*RevisionHistory, latest string) ([]*RevisionHistory, []*RevisionHistory) {
+	var latestRHs, oldRHs []*RevisionHistory
+	for _, rh := range rhs {
+		if rh.Name == latest {
+			latestRHs = append(latestRHs, rh)
+			continue
+		}
+		oldRHs = append(oldRHs, rh)
+	}
+	return latestRHs, oldRHs
+}
+
+type controllerRevisionsByRevision []*appsv1.ControllerRevision
+
+func (r controllerRevisionsByRevision) Len() int {
+	return len(r)
+}
+
+func (r controllerRevisionsByRevision) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+}
+
+func (r controllerRevisionsByRevision) Less(i, j int) bool {
+	if r[i].Revision == r[j].Revision {
+		return r[i].CreationTimestamp.Before(&r[j].CreationTimestamp)
+	}
+	return r[i].Revision < r[j].Revision
+}
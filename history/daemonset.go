@@ -0,0 +1,72 @@
+package history
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type DaemonSetViewer struct {
+	c        kubernetes.Interface
+	pageSize int64
+}
+
+// DaemonsetViewer is the old name of DaemonSetViewer.
+//
+// Deprecated: use DaemonSetViewer instead.
+type DaemonsetViewer = DaemonSetViewer
+
+// ViewHistory returns the newest ControllerRevision owned by the DaemonSet as the latest revision,
+// and the others as the old revisions. The DaemonSet runs one pod on each node, so the replicas
+// of each revision is the number of the nodes running the revision.
+func (h *DaemonSetViewer) ViewHistory(ctx context.Context, namespace, name string) ([]*RevisionHistory, []*RevisionHistory, error) {
+	ds, err := h.c.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revisions, err := listControllerRevisions(ctx, h.c, ds.Namespace, ds.Spec.Selector, ds, h.pageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pods, err := listPods(ctx, h.c, ds.Namespace, ds.Spec.Selector, ds, h.pageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	latest, olds := daemonSetHistory(ds, revisions, pods)
+	return latest, olds, nil
+}
+
+func daemonSetHistory(ds *appsv1.DaemonSet, revisions []*appsv1.ControllerRevision, pods []*corev1.Pod) ([]*RevisionHistory, []*RevisionHistory) {
+	rhs := controllerRevisionsToRevisionHistory(revisions, pods, ds.Spec.MinReadySeconds)
+	if len(rhs) == 0 {
+		return nil, nil
+	}
+
+	// the controller always bumps the revision of the ControllerRevision matched the DaemonSet template
+	latestRH := rhs[len(rhs)-1]
+	latestRH.CurrentRevision = true
+	latestRH.UpdateRevision = true
+
+	latest, olds := splitRevisionHistory(rhs, latestRH.Name)
+	setHistoryPositions(latest, olds, ds.Spec.RevisionHistoryLimit)
+	return latest, olds
+}
+
+func (h *DaemonSetViewer) DiffRevisions(ctx context.Context, namespace, name string, from, to int64) (*RevisionDiff, error) {
+	ds, err := h.c.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := listControllerRevisions(ctx, h.c, ds.Namespace, ds.Spec.Selector, ds, h.pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return diffControllerRevisions(revisions, from, to)
+}
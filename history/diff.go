@@ -0,0 +1,289 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Differ diffs the pod templates of two revisions of the workload.
+type Differ interface {
+	DiffRevisions(ctx context.Context, namespace, name string, from, to int64) (*RevisionDiff, error)
+}
+
+// DifferFor returns the Differ of the kind, the viewers returned by ViewerFor are also Differ.
+func DifferFor(c kubernetes.Interface, kind schema.GroupKind, opts ...Option) (Differ, error) {
+	v, err := ViewerFor(c, kind, opts...)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := v.(Differ)
+	if !ok {
+		return nil, &UnsupportedKindError{Kind: kind}
+	}
+	return d, nil
+}
+
+type ChangeType string
+
+const (
+	ChangeTypeAdded    ChangeType = "added"
+	ChangeTypeRemoved  ChangeType = "removed"
+	ChangeTypeModified ChangeType = "modified"
+)
+
+// Change is a change of the pod template between two revisions.
+type Change struct {
+	// Container is the container name, it's empty if the field belongs to the pod, e.g. volumes.
+	Container string `json:"container,omitempty"`
+	// Field is the changed field, e.g. image, env.FOO, resources.limits.memory, volumes.data, livenessProbe.
+	Field string     `json:"field"`
+	Type  ChangeType `json:"type"`
+	From  string     `json:"from,omitempty"`
+	To    string     `json:"to,omitempty"`
+}
+
+func (c Change) String() string {
+	field := c.Field
+	if c.Container != "" {
+		field = fmt.Sprintf("%s of container %s", c.Field, c.Container)
+	}
+
+	switch c.Type {
+	case ChangeTypeAdded:
+		return fmt.Sprintf("added %s", field)
+	case ChangeTypeRemoved:
+		return fmt.Sprintf("removed %s", field)
+	}
+	return fmt.Sprintf("changed %s from %s to %s", field, c.From, c.To)
+}
+
+// RevisionDiff is the difference of the pod templates between two revisions.
+type RevisionDiff struct {
+	From    int64    `json:"from"`
+	To      int64    `json:"to"`
+	Changes []Change `json:"changes"`
+	// Unified is the unified diff of the pod templates in YAML.
+	Unified string `json:"unified"`
+}
+
+// Summary returns the human readable summary of the changes,
+// e.g. "revision 7 changed image of container nginx from nginx:1.0 to nginx:1.1".
+func (d *RevisionDiff) Summary() string {
+	if len(d.Changes) == 0 {
+		return fmt.Sprintf("revision %d has no changes from revision %d", d.To, d.From)
+	}
+
+	changes := make([]string, 0, len(d.Changes))
+	for _, c := range d.Changes {
+		changes = append(changes, c.String())
+	}
+	return fmt.Sprintf("revision %d %s", d.To, strings.Join(changes, ", "))
+}
+
+// DiffTemplates returns the diff between the two pod templates.
+func DiffTemplates(from, to *corev1.PodTemplateSpec, fromRevision, toRevision int64) (*RevisionDiff, error) {
+	unified, err := unifiedDiff(from, to, fromRevision, toRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RevisionDiff{
+		From:    fromRevision,
+		To:      toRevision,
+		Changes: diffPodSpec(&from.Spec, &to.Spec),
+		Unified: unified,
+	}, nil
+}
+
+func unifiedDiff(from, to *corev1.PodTemplateSpec, fromRevision, toRevision int64) (string, error) {
+	a, err := yaml.Marshal(from)
+	if err != nil {
+		return "", err
+	}
+	b, err := yaml.Marshal(to)
+	if err != nil {
+		return "", err
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(a)),
+		B:        difflib.SplitLines(string(b)),
+		FromFile: fmt.Sprintf("revision %d", fromRevision),
+		ToFile:   fmt.Sprintf("revision %d", toRevision),
+		Context:  3,
+	})
+}
+
+func diffPodSpec(from, to *corev1.PodSpec) []Change {
+	var changes []Change
+
+	fromContainers := containersByName(from)
+	toContainers := containersByName(to)
+	for _, name := range containerNames(from, to) {
+		a, inFrom := fromContainers[name]
+		b, inTo := toContainers[name]
+		switch {
+		case !inFrom:
+			changes = append(changes, Change{Container: name, Field: "container", Type: ChangeTypeAdded, To: b.Image})
+		case !inTo:
+			changes = append(changes, Change{Container: name, Field: "container", Type: ChangeTypeRemoved, From: a.Image})
+		default:
+			changes = append(changes, diffContainer(a, b)...)
+		}
+	}
+
+	fromVolumes := make(map[string]string, len(from.Volumes))
+	for _, v := range from.Volumes {
+		fromVolumes[v.Name] = toJSON(v.VolumeSource)
+	}
+	toVolumes := make(map[string]string, len(to.Volumes))
+	for _, v := range to.Volumes {
+		toVolumes[v.Name] = toJSON(v.VolumeSource)
+	}
+	changes = append(changes, diffStringMaps("", "volumes.", fromVolumes, toVolumes)...)
+
+	return changes
+}
+
+func diffContainer(from, to *corev1.Container) []Change {
+	var changes []Change
+	name := from.Name
+
+	if from.Image != to.Image {
+		changes = append(changes, Change{Container: name, Field: "image", Type: ChangeTypeModified, From: from.Image, To: to.Image})
+	}
+
+	changes = append(changes, diffStringMaps(name, "env.", envMap(from.Env), envMap(to.Env))...)
+	changes = append(changes, diffStringMaps(name, "resources.requests.", resourceMap(from.Resources.Requests), resourceMap(to.Resources.Requests))...)
+	changes = append(changes, diffStringMaps(name, "resources.limits.", resourceMap(from.Resources.Limits), resourceMap(to.Resources.Limits))...)
+
+	probes := []struct {
+		field    string
+		from, to *corev1.Probe
+	}{
+		{"livenessProbe", from.LivenessProbe, to.LivenessProbe},
+		{"readinessProbe", from.ReadinessProbe, to.ReadinessProbe},
+		{"startupProbe", from.StartupProbe, to.StartupProbe},
+	}
+	for _, p := range probes {
+		switch {
+		case p.from == nil && p.to == nil:
+		case p.from == nil:
+			changes = append(changes, Change{Container: name, Field: p.field, Type: ChangeTypeAdded, To: toJSON(p.to)})
+		case p.to == nil:
+			changes = append(changes, Change{Container: name, Field: p.field, Type: ChangeTypeRemoved, From: toJSON(p.from)})
+		case !apiequality.Semantic.DeepEqual(p.from, p.to):
+			changes = append(changes, Change{Container: name, Field: p.field, Type: ChangeTypeModified, From: toJSON(p.from), To: toJSON(p.to)})
+		}
+	}
+
+	return changes
+}
+
+// diffStringMaps diffs the two maps, the field of the change is prefix + key.
+func diffStringMaps(container, prefix string, from, to map[string]string) []Change {
+	var changes []Change
+	for _, k := range unionKeys(from, to) {
+		a, inFrom := from[k]
+		b, inTo := to[k]
+		switch {
+		case !inFrom:
+			changes = append(changes, Change{Container: container, Field: prefix + k, Type: ChangeTypeAdded, To: b})
+		case !inTo:
+			changes = append(changes, Change{Container: container, Field: prefix + k, Type: ChangeTypeRemoved, From: a})
+		case a != b:
+			changes = append(changes, Change{Container: container, Field: prefix + k, Type: ChangeTypeModified, From: a, To: b})
+		}
+	}
+	return changes
+}
+
+// containersByName returns the init containers and containers by name, the name is unique in the pod.
+func containersByName(spec *corev1.PodSpec) map[string]*corev1.Container {
+	containers := make(map[string]*corev1.Container, len(spec.InitContainers)+len(spec.Containers))
+	for i := range spec.InitContainers {
+		containers[spec.InitContainers[i].Name] = &spec.InitContainers[i]
+	}
+	for i := range spec.Containers {
+		containers[spec.Containers[i].Name] = &spec.Containers[i]
+	}
+	return containers
+}
+
+// containerNames returns the container names of the two pods in order, the containers only in to are last.
+func containerNames(from, to *corev1.PodSpec) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, spec := range []*corev1.PodSpec{from, to} {
+		for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+			for _, c := range containers {
+				if !seen[c.Name] {
+					seen[c.Name] = true
+					names = append(names, c.Name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+func envMap(envs []corev1.EnvVar) map[string]string {
+	m := make(map[string]string, len(envs))
+	for _, e := range envs {
+		if e.ValueFrom != nil {
+			m[e.Name] = toJSON(e.ValueFrom)
+			continue
+		}
+		m[e.Name] = e.Value
+	}
+	return m
+}
+
+func resourceMap(list corev1.ResourceList) map[string]string {
+	m := make(map[string]string, len(list))
+	for name, quantity := range list {
+		m[string(name)] = quantity.String()
+	}
+	return m
+}
+
+// unionKeys returns the sorted keys of the two maps.
+func unionKeys(a, b map[string]string) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func toJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// replicaSetTemplate returns the pod template of the ReplicaSet without the pod-template-hash label.
+func replicaSetTemplate(rs *appsv1.ReplicaSet) *corev1.PodTemplateSpec {
+	template := rs.Spec.Template.DeepCopy()
+	delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+	return template
+}
@@ -0,0 +1,68 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// UnsupportedKindError is returned when the kind has no revision history.
+type UnsupportedKindError struct {
+	Kind schema.GroupKind
+}
+
+func (e *UnsupportedKindError) Error() string {
+	return fmt.Sprintf("no history for kind %s", e.Kind.String())
+}
+
+// RevisionNotFoundError is returned when the revision is not found in the history,
+// the Revision 0 means the previous revision.
+type RevisionNotFoundError struct {
+	Revision int64
+}
+
+func (e *RevisionNotFoundError) Error() string {
+	if e.Revision == 0 {
+		return "no rollout history found"
+	}
+	return fmt.Sprintf("unable to find specified revision %d in history", e.Revision)
+}
+
+// RollbackSkippedError is returned when the current template already matches the revision to rollback.
+type RollbackSkippedError struct {
+	Revision int64
+}
+
+func (e *RollbackSkippedError) Error() string {
+	return fmt.Sprintf("skipped rollback (current template already matches revision %d)", e.Revision)
+}
+
+// ProgressDeadlineExceededError is returned when the Deployment exceeded its progress deadline.
+type ProgressDeadlineExceededError struct {
+	Name string
+}
+
+func (e *ProgressDeadlineExceededError) Error() string {
+	return fmt.Sprintf("deployment %q exceeded its progress deadline", e.Name)
+}
+
+func IsUnsupportedKind(err error) bool {
+	var e *UnsupportedKindError
+	return errors.As(err, &e)
+}
+
+func IsRevisionNotFound(err error) bool {
+	var e *RevisionNotFoundError
+	return errors.As(err, &e)
+}
+
+func IsRollbackSkipped(err error) bool {
+	var e *RollbackSkippedError
+	return errors.As(err, &e)
+}
+
+func IsProgressDeadlineExceeded(err error) bool {
+	var e *ProgressDeadlineExceededError
+	return errors.As(err, &e)
+}
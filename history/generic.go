@@ -0,0 +1,103 @@
+package history
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ControllerRevisionViewer views the history of any workload which follows the StatefulSet convention:
+// the revisions are saved in the ControllerRevisions controlled by the workload, the data of the revision
+// is the patch of spec.template, and the pods are labeled with controller-revision-hash.
+// The status.currentRevision and status.updateRevision of the workload are used if they exist.
+type ControllerRevisionViewer struct {
+	dynamicClient dynamic.Interface
+	c             kubernetes.Interface
+	resource      schema.GroupVersionResource
+	pageSize      int64
+}
+
+var _ Viewer = &ControllerRevisionViewer{}
+var _ Differ = &ControllerRevisionViewer{}
+
+// NewControllerRevisionViewer returns the ControllerRevisionViewer of the namespaced workload resource,
+// the workload is got by the dynamic client.
+func NewControllerRevisionViewer(dynamicClient dynamic.Interface, c kubernetes.Interface, resource schema.GroupVersionResource, opts ...Option) *ControllerRevisionViewer {
+	o := newOptions(opts...)
+	return &ControllerRevisionViewer{
+		dynamicClient: dynamicClient,
+		c:             c,
+		resource:      resource,
+		pageSize:      o.PageSize,
+	}
+}
+
+func (h *ControllerRevisionViewer) ViewHistory(ctx context.Context, namespace, name string) ([]*RevisionHistory, []*RevisionHistory, error) {
+	obj, selector, err := h.get(ctx, namespace, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revisions, err := listControllerRevisions(ctx, h.c, namespace, selector, obj, h.pageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pods, err := listPods(ctx, h.c, namespace, selector, obj, h.pageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	minReadySeconds, _, _ := unstructured.NestedInt64(obj.Object, "spec", "minReadySeconds")
+	currentRevision, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	updateRevision, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+	var revisionHistoryLimit *int32
+	if limit, found, _ := unstructured.NestedInt64(obj.Object, "spec", "revisionHistoryLimit"); found {
+		l := int32(limit)
+		revisionHistoryLimit = &l
+	}
+
+	latest, olds := controllerRevisionHistory(revisions, pods, int32(minReadySeconds), currentRevision, updateRevision, revisionHistoryLimit)
+	return latest, olds, nil
+}
+
+func (h *ControllerRevisionViewer) DiffRevisions(ctx context.Context, namespace, name string, from, to int64) (*RevisionDiff, error) {
+	obj, selector, err := h.get(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := listControllerRevisions(ctx, h.c, namespace, selector, obj, h.pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return diffControllerRevisions(revisions, from, to)
+}
+
+// get returns the workload and its spec.selector.
+func (h *ControllerRevisionViewer) get(ctx context.Context, namespace, name string) (*unstructured.Unstructured, *metav1.LabelSelector, error) {
+	obj, err := h.dynamicClient.Resource(h.resource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, found, err := unstructured.NestedMap(obj.Object, "spec", "selector")
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("%s %s/%s has no spec.selector", h.resource.Resource, namespace, name)
+	}
+
+	selector := &metav1.LabelSelector{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, selector); err != nil {
+		return nil, nil, err
+	}
+	return obj, selector, nil
+}
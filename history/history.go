@@ -2,7 +2,6 @@ package history
 
 import (
 	"context"
-	"fmt"
 	"sort"
 	"strconv"
 
@@ -14,6 +13,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
+	"k8s.io/client-go/tools/pager"
 	"k8s.io/klog/v2"
 )
 
@@ -22,32 +22,73 @@ const (
 )
 
 type DeploymentViewer struct {
-	c kubernetes.Interface
+	c        kubernetes.Interface
+	pageSize int64
 }
 
-func (h *DeploymentViewer) ViewHistory(namespace, name string) ([]*RevisionHistory, []*RevisionHistory, error) {
+func (h *DeploymentViewer) ViewHistory(ctx context.Context, namespace, name string) ([]*RevisionHistory, []*RevisionHistory, error) {
 	appsClient := h.c.AppsV1()
-	deployment, err := appsClient.Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	deployment, err := appsClient.Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return nil, nil, err
 	}
 
-	rsList, err := listReplicaSets(appsClient, deployment)
+	rsList, err := listReplicaSets(ctx, appsClient, deployment, h.pageSize)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	return deploymentHistory(deployment, rsList)
+}
+
+// deploymentHistory returns the new ReplicaSet as the latest revision, and the old ReplicaSets as the old revisions.
+func deploymentHistory(deployment *appsv1.Deployment, rsList []*appsv1.ReplicaSet) ([]*RevisionHistory, []*RevisionHistory, error) {
 	newRS := findNewReplicaSet(deployment, rsList)
 	oldRSs := findOldReplicaSets(rsList, newRS)
 
-	newRH, err := singleReplicaSetToRevisionHistory(newRS)
-	if err != nil {
-		return nil, nil, err
+	latest := make([]*RevisionHistory, 0, 1)
+	if newRS != nil {
+		newRH, err := singleReplicaSetToRevisionHistory(newRS)
+		if err != nil {
+			return nil, nil, err
+		}
+		newRH.CurrentRevision = true
+		newRH.UpdateRevision = true
+		latest = append(latest, &newRH)
 	}
 
 	oldRHs := replicaSetsToRevisionHistory(oldRSs)
+	setHistoryPositions(latest, oldRHs, deployment.Spec.RevisionHistoryLimit)
+
+	return latest, oldRHs, nil
+}
+
+func (h *DeploymentViewer) DiffRevisions(ctx context.Context, namespace, name string, from, to int64) (*RevisionDiff, error) {
+	appsClient := h.c.AppsV1()
+	deployment, err := appsClient.Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	rsList, err := listReplicaSets(ctx, appsClient, deployment, h.pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return diffReplicaSets(rsList, from, to)
+}
+
+// diffReplicaSets diffs the pod templates of the two revisions.
+func diffReplicaSets(rsList []*appsv1.ReplicaSet, from, to int64) (*RevisionDiff, error) {
+	fromRS, _, err := findReplicaSetForRevision(rsList, from)
+	if err != nil {
+		return nil, err
+	}
+	toRS, _, err := findReplicaSetForRevision(rsList, to)
+	if err != nil {
+		return nil, err
+	}
 
-	return []*RevisionHistory{&newRH}, oldRHs, nil
+	return DiffTemplates(replicaSetTemplate(fromRS), replicaSetTemplate(toRS), from, to)
 }
 
 func replicaSetsToRevisionHistory(rsList []*appsv1.ReplicaSet) []*RevisionHistory {
@@ -76,15 +117,6 @@ func singleReplicaSetToRevisionHistory(rs *appsv1.ReplicaSet) (RevisionHistory,
 		AvailableReplicas:    rs.Status.AvailableReplicas,
 	}
 
-	images := make([]string, 0)
-	for _, c := range rs.Spec.Template.Spec.InitContainers {
-		images = append(images, c.Image)
-	}
-
-	for _, c := range rs.Spec.Template.Spec.Containers {
-		images = append(images, c.Image)
-	}
-
 	return RevisionHistory{
 		Revision:        revision,
 		Name:            rs.Name,
@@ -92,10 +124,25 @@ func singleReplicaSetToRevisionHistory(rs *appsv1.ReplicaSet) (RevisionHistory,
 		Annotations:     rs.Annotations,
 		CreateTimestamp: rs.CreationTimestamp,
 		Status:          status,
-		Images:          images,
+		Images:          templateImages(&rs.Spec.Template),
+		Template:        rs.Spec.Template,
+		ChangeCause:     rs.Annotations[ChangeCauseAnnotation],
 	}, nil
 }
 
+// templateImages returns the images of the init containers and containers.
+func templateImages(template *corev1.PodTemplateSpec) []string {
+	images := make([]string, 0)
+	for _, c := range template.Spec.InitContainers {
+		images = append(images, c.Image)
+	}
+
+	for _, c := range template.Spec.Containers {
+		images = append(images, c.Image)
+	}
+	return images
+}
+
 func Revision(obj runtime.Object) (int64, error) {
 	acc, err := meta.Accessor(obj)
 	if err != nil {
@@ -156,42 +203,38 @@ func (r replicaSetsByCreationTimestamp) Less(i, j int) bool {
 	return r[i].CreationTimestamp.Before(&r[j].CreationTimestamp)
 }
 
-func listReplicaSets(appsClient appsv1client.AppsV1Interface, deployment *appsv1.Deployment) ([]*appsv1.ReplicaSet, error) {
+func listReplicaSets(ctx context.Context, appsClient appsv1client.AppsV1Interface, deployment *appsv1.Deployment, pageSize int64) ([]*appsv1.ReplicaSet, error) {
 	labelSelector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
 	if err != nil {
 		return nil, err
 	}
 
 	options := metav1.ListOptions{LabelSelector: labelSelector.String()}
-	rsList, err := appsClient.ReplicaSets(deployment.Namespace).List(context.TODO(), options)
-	if err != nil {
-		return nil, err
+	listFunc := func(opts metav1.ListOptions) (runtime.Object, error) {
+		return appsClient.ReplicaSets(deployment.Namespace).List(ctx, opts)
 	}
 
-	list := rsList.Items
 	// 获取属于该deployment的ReplicaSet
-	owned := make([]*appsv1.ReplicaSet, 0, len(list))
-	for i := range list {
-		if metav1.IsControlledBy(&list[i], deployment) {
-			owned = append(owned, &list[i])
+	owned := make([]*appsv1.ReplicaSet, 0)
+	err = eachListItem(ctx, pageSize, options, listFunc, func(obj runtime.Object) {
+		if rs, ok := obj.(*appsv1.ReplicaSet); ok && metav1.IsControlledBy(rs, deployment) {
+			owned = append(owned, rs)
 		}
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return owned, nil
 }
 
-type StatefulSetViewer struct {
-	c kubernetes.Interface
-}
-
-func (h *StatefulSetViewer) ViewHistory(namespace, name string) ([]*RevisionHistory, []*RevisionHistory, error) {
-	return nil, nil, fmt.Errorf("not implement")
-}
-
-type DaemonsetViewer struct {
-	c kubernetes.Interface
-}
-
-func (h *DaemonsetViewer) ViewHistory(namespace, name string) ([]*RevisionHistory, []*RevisionHistory, error) {
-	return nil, nil, fmt.Errorf("not implement")
+// eachListItem lists the objects page by page with the Limit/Continue, and calls fn for each object.
+// The pageSize 0 means list all objects in one request.
+func eachListItem(ctx context.Context, pageSize int64, options metav1.ListOptions, listFunc func(metav1.ListOptions) (runtime.Object, error), fn func(obj runtime.Object)) error {
+	p := pager.New(pager.SimplePageFunc(listFunc))
+	p.PageSize = pageSize
+	return p.EachListItem(ctx, options, func(obj runtime.Object) error {
+		fn(obj)
+		return nil
+	})
 }
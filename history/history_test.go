@@ -0,0 +1,544 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	typedappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+)
+
+var testLabels = map[string]string{"app": "demo"}
+
+func testPodTemplate(image string) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: testLabels},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "demo", Image: image}},
+		},
+	}
+}
+
+func testOwnerReference(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{
+		APIVersion: "apps/v1",
+		Kind:       kind,
+		Name:       name,
+		UID:        "abcdef",
+		Controller: &controller,
+	}}
+}
+
+// testControllerRevision returns the ControllerRevision the same as the StatefulSet/DaemonSet controller created.
+func testControllerRevision(kind, owner, hash string, revision int64, image string) *appsv1.ControllerRevision {
+	raw := []byte(fmt.Sprintf(`{"spec":{"template":{"$patch":"replace","metadata":{"labels":{"app":"demo"}},"spec":{"containers":[{"name":"demo","image":%q}]}}}}`, image))
+
+	return &appsv1.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            owner + "-" + hash,
+			Namespace:       metav1.NamespaceDefault,
+			Labels:          map[string]string{"app": "demo", appsv1.ControllerRevisionHashLabelKey: hash},
+			OwnerReferences: testOwnerReference(kind, owner),
+		},
+		Data:     runtime.RawExtension{Raw: raw},
+		Revision: revision,
+	}
+}
+
+func testPod(kind, owner, name, revisionHash string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       metav1.NamespaceDefault,
+			Labels:          map[string]string{"app": "demo", appsv1.ControllerRevisionHashLabelKey: revisionHash},
+			OwnerReferences: testOwnerReference(kind, owner),
+		},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+		},
+	}
+}
+
+func TestStatefulSetViewHistory(t *testing.T) {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: metav1.NamespaceDefault, UID: "abcdef"},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+			Template: testPodTemplate("nginx:1.1"),
+		},
+		Status: appsv1.StatefulSetStatus{
+			CurrentRevision: "demo-v1",
+			UpdateRevision:  "demo-v2",
+		},
+	}
+
+	client := fake.NewSimpleClientset(sts,
+		testControllerRevision("StatefulSet", "demo", "v1", 1, "nginx:1.0"),
+		testControllerRevision("StatefulSet", "demo", "v2", 2, "nginx:1.1"),
+		testPod("StatefulSet", "demo", "demo-0", "demo-v2", true),
+		testPod("StatefulSet", "demo", "demo-1", "demo-v1", true),
+		testPod("StatefulSet", "demo", "demo-2", "demo-v1", false),
+	)
+
+	viewer, err := ViewerFor(client, schema.GroupKind{Group: "apps", Kind: "StatefulSet"})
+	assert.Nil(t, err)
+	latest, olds, err := viewer.ViewHistory(context.TODO(), metav1.NamespaceDefault, "demo")
+	assert.Nil(t, err)
+	assert.Len(t, latest, 1)
+	assert.Len(t, olds, 1)
+
+	assert.Equal(t, int64(2), latest[0].Revision)
+	assert.Equal(t, []string{"nginx:1.1"}, latest[0].Images)
+	assert.True(t, latest[0].UpdateRevision)
+	assert.False(t, latest[0].CurrentRevision)
+	assert.Equal(t, HistoryStatus{DesiredReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}, latest[0].Status)
+
+	assert.Equal(t, int64(1), olds[0].Revision)
+	assert.Equal(t, []string{"nginx:1.0"}, olds[0].Images)
+	assert.True(t, olds[0].CurrentRevision)
+	assert.Equal(t, HistoryStatus{DesiredReplicas: 2, ReadyReplicas: 1, AvailableReplicas: 1}, olds[0].Status)
+}
+
+func TestDaemonSetViewHistory(t *testing.T) {
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: metav1.NamespaceDefault, UID: "abcdef"},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+			Template: testPodTemplate("nginx:1.1"),
+		},
+	}
+
+	latestRevision := testControllerRevision("DaemonSet", "demo", "v2", 3, "nginx:1.1")
+	latestRevision.Annotations = map[string]string{ChangeCauseAnnotation: "image updated"}
+	client := fake.NewSimpleClientset(ds,
+		latestRevision,
+		testControllerRevision("DaemonSet", "demo", "v1", 2, "nginx:1.0"),
+		testPod("DaemonSet", "demo", "demo-a", "v2", true),
+		testPod("DaemonSet", "demo", "demo-b", "v2", false),
+		testPod("DaemonSet", "demo", "demo-c", "v1", true),
+	)
+
+	viewer, err := ViewerFor(client, schema.GroupKind{Group: "apps", Kind: "DaemonSet"})
+	assert.Nil(t, err)
+	latest, olds, err := viewer.ViewHistory(context.TODO(), metav1.NamespaceDefault, "demo")
+	assert.Nil(t, err)
+	assert.Len(t, latest, 1)
+	assert.Len(t, olds, 1)
+
+	assert.Equal(t, int64(3), latest[0].Revision)
+	assert.Equal(t, "demo-v2", latest[0].Name)
+	assert.True(t, latest[0].UpdateRevision)
+	assert.Equal(t, HistoryStatus{DesiredReplicas: 2, ReadyReplicas: 1, AvailableReplicas: 1}, latest[0].Status)
+
+	assert.Equal(t, int64(2), olds[0].Revision)
+	assert.Equal(t, HistoryStatus{DesiredReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}, olds[0].Status)
+
+	assert.Equal(t, "nginx:1.1", latest[0].Template.Spec.Containers[0].Image)
+	assert.Equal(t, "image updated", latest[0].ChangeCause)
+	assert.Equal(t, 0, latest[0].HistoryPosition)
+	assert.Equal(t, 1, olds[0].HistoryPosition)
+	assert.Equal(t, DefaultRevisionHistoryLimit, olds[0].RevisionHistoryLimit)
+}
+
+func TestDaemonSetRollback(t *testing.T) {
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: metav1.NamespaceDefault, UID: "abcdef"},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+			Template: testPodTemplate("nginx:1.1"),
+		},
+	}
+
+	client := fake.NewSimpleClientset(ds,
+		testControllerRevision("DaemonSet", "demo", "v2", 3, "nginx:1.1"),
+		testControllerRevision("DaemonSet", "demo", "v1", 2, "nginx:1.0"),
+	)
+	rollbacker, err := RollbackerFor(client, schema.GroupKind{Group: "apps", Kind: "DaemonSet"})
+	assert.Nil(t, err)
+
+	_, err = rollbacker.Rollback(context.TODO(), metav1.NamespaceDefault, "demo", 3, false)
+	assert.True(t, IsRollbackSkipped(err))
+
+	_, err = rollbacker.Rollback(context.TODO(), metav1.NamespaceDefault, "demo", 1, false)
+	assert.True(t, IsRevisionNotFound(err))
+
+	revision, err := rollbacker.Rollback(context.TODO(), metav1.NamespaceDefault, "demo", 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), revision)
+
+	ds, err = client.AppsV1().DaemonSets(metav1.NamespaceDefault).Get(context.TODO(), "demo", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx:1.0", ds.Spec.Template.Spec.Containers[0].Image)
+}
+
+func TestDeploymentRollbackPaused(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: metav1.NamespaceDefault},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+			Template: testPodTemplate("nginx:1.1"),
+			Paused:   true,
+		},
+	}
+
+	client := fake.NewSimpleClientset(deployment)
+	rollbacker, err := RollbackerFor(client, schema.GroupKind{Group: "apps", Kind: "Deployment"})
+	assert.Nil(t, err)
+	_, err = rollbacker.Rollback(context.TODO(), metav1.NamespaceDefault, "demo", 0, false)
+	assert.NotNil(t, err)
+}
+
+func testReplicaSet(name string, revision int64, image string) *appsv1.ReplicaSet {
+	template := testPodTemplate(image)
+	template.Labels = map[string]string{"app": "demo", appsv1.DefaultDeploymentUniqueLabelKey: name}
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       metav1.NamespaceDefault,
+			UID:             types.UID(name),
+			Labels:          testLabels,
+			Annotations:     map[string]string{DeploymentRevisionAnnotation: fmt.Sprint(revision)},
+			OwnerReferences: testOwnerReference("Deployment", "demo"),
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+			Template: template,
+		},
+	}
+}
+
+// patchOptionsRecorder records the options of the Deployment patches, the fake clientset doesn't keep them.
+type patchOptionsRecorder struct {
+	kubernetes.Interface
+	options []metav1.PatchOptions
+}
+
+func (r *patchOptionsRecorder) AppsV1() typedappsv1.AppsV1Interface {
+	return &recordingAppsV1{AppsV1Interface: r.Interface.AppsV1(), r: r}
+}
+
+type recordingAppsV1 struct {
+	typedappsv1.AppsV1Interface
+	r *patchOptionsRecorder
+}
+
+func (c *recordingAppsV1) Deployments(namespace string) typedappsv1.DeploymentInterface {
+	return &recordingDeployments{DeploymentInterface: c.AppsV1Interface.Deployments(namespace), r: c.r}
+}
+
+type recordingDeployments struct {
+	typedappsv1.DeploymentInterface
+	r *patchOptionsRecorder
+}
+
+func (c *recordingDeployments) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*appsv1.Deployment, error) {
+	c.r.options = append(c.r.options, opts)
+	return c.DeploymentInterface.Patch(ctx, name, pt, data, opts, subresources...)
+}
+
+func TestDeploymentRollback(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: metav1.NamespaceDefault, UID: "abcdef"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+			Template: testPodTemplate("nginx:1.2"),
+		},
+	}
+
+	client := fake.NewSimpleClientset(deployment,
+		testReplicaSet("demo-a", 1, "nginx:1.0"),
+		testReplicaSet("demo-b", 2, "nginx:1.1"),
+		testReplicaSet("demo-c", 3, "nginx:1.2"),
+	)
+	recorder := &patchOptionsRecorder{Interface: client}
+	rollbacker, err := RollbackerFor(recorder, schema.GroupKind{Group: "apps", Kind: "Deployment"})
+	assert.Nil(t, err)
+
+	_, err = rollbacker.Rollback(context.TODO(), metav1.NamespaceDefault, "demo", 3, false)
+	assert.True(t, IsRollbackSkipped(err))
+
+	revision, err := rollbacker.Rollback(context.TODO(), metav1.NamespaceDefault, "demo", 1, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), revision)
+	assert.Len(t, recorder.options, 1)
+	assert.Equal(t, []string{metav1.DryRunAll}, recorder.options[0].DryRun)
+
+	revision, err = rollbacker.Rollback(context.TODO(), metav1.NamespaceDefault, "demo", 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), revision)
+	assert.Len(t, recorder.options, 2)
+	assert.Empty(t, recorder.options[1].DryRun)
+
+	deployment, err = client.AppsV1().Deployments(metav1.NamespaceDefault).Get(context.TODO(), "demo", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx:1.1", deployment.Spec.Template.Spec.Containers[0].Image)
+	_, ok := deployment.Spec.Template.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+	assert.False(t, ok)
+}
+
+func TestDiffTemplates(t *testing.T) {
+	from := testPodTemplate("nginx:1.0")
+	from.Spec.Containers[0].Env = []corev1.EnvVar{{Name: "FOO", Value: "foo"}, {Name: "BAR", Value: "bar"}}
+	from.Spec.Containers[0].Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")}
+
+	to := testPodTemplate("nginx:1.1")
+	to.Spec.Containers[0].Env = []corev1.EnvVar{{Name: "FOO", Value: "foo"}, {Name: "BAZ", Value: "baz"}}
+	to.Spec.Containers[0].Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")}
+	to.Spec.Volumes = []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+	to.Spec.Containers = append(to.Spec.Containers, corev1.Container{Name: "sidecar", Image: "busybox"})
+
+	diff, err := DiffTemplates(&from, &to, 6, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, []Change{
+		{Container: "demo", Field: "image", Type: ChangeTypeModified, From: "nginx:1.0", To: "nginx:1.1"},
+		{Container: "demo", Field: "env.BAR", Type: ChangeTypeRemoved, From: "bar"},
+		{Container: "demo", Field: "env.BAZ", Type: ChangeTypeAdded, To: "baz"},
+		{Container: "demo", Field: "resources.limits.memory", Type: ChangeTypeModified, From: "128Mi", To: "256Mi"},
+		{Container: "sidecar", Field: "container", Type: ChangeTypeAdded, To: "busybox"},
+		{Field: "volumes.data", Type: ChangeTypeAdded, To: `{"emptyDir":{}}`},
+	}, diff.Changes)
+	assert.Contains(t, diff.Summary(), "revision 7 changed image of container demo from nginx:1.0 to nginx:1.1")
+	assert.Contains(t, diff.Unified, "-    image: nginx:1.0")
+	assert.Contains(t, diff.Unified, "+    image: nginx:1.1")
+}
+
+func TestViewerForUnsupportedKind(t *testing.T) {
+	_, err := ViewerFor(fake.NewSimpleClientset(), schema.GroupKind{Group: "batch", Kind: "Job"})
+	assert.True(t, IsUnsupportedKind(err))
+}
+
+func TestDeploymentViewHistoryPaginated(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: metav1.NamespaceDefault, UID: "abcdef"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+			Template: testPodTemplate("nginx:1.2"),
+		},
+	}
+
+	client := fake.NewSimpleClientset(deployment,
+		testReplicaSet("demo-a", 1, "nginx:1.0"),
+		testReplicaSet("demo-b", 2, "nginx:1.1"),
+		testReplicaSet("demo-c", 3, "nginx:1.2"),
+	)
+
+	viewer, err := ViewerFor(client, schema.GroupKind{Group: "apps", Kind: "Deployment"}, WithPageSize(1))
+	assert.Nil(t, err)
+	latest, olds, err := viewer.ViewHistory(context.TODO(), metav1.NamespaceDefault, "demo")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), latest[0].Revision)
+	assert.Len(t, olds, 2)
+
+	_, _, err = viewer.ViewHistory(context.TODO(), metav1.NamespaceDefault, "notfound")
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestCachedDeploymentViewHistory(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: metav1.NamespaceDefault, UID: "abcdef"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+			Template: testPodTemplate("nginx:1.1"),
+		},
+	}
+	client := fake.NewSimpleClientset(deployment,
+		testReplicaSet("demo-a", 1, "nginx:1.0"),
+		testReplicaSet("demo-b", 2, "nginx:1.1"),
+	)
+
+	factory := informers.NewSharedInformerFactory(client, 0)
+	viewer, err := CachedViewerFor(factory, schema.GroupKind{Group: "apps", Kind: "Deployment"})
+	assert.Nil(t, err)
+
+	events := make(chan RevisionEvent, 10)
+	AddRevisionHandler(factory, func(e RevisionEvent) {
+		events <- e
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+
+	client.ClearActions()
+	latest, olds, err := viewer.ViewHistory(context.TODO(), metav1.NamespaceDefault, "demo")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), latest[0].Revision)
+	assert.Len(t, olds, 1)
+	assert.Empty(t, client.Actions())
+
+	_, err = client.AppsV1().ReplicaSets(metav1.NamespaceDefault).Create(context.TODO(), testReplicaSet("demo-c", 3, "nginx:1.2"), metav1.CreateOptions{})
+	assert.Nil(t, err)
+
+	timeout := time.After(wait.ForeverTestTimeout)
+	for {
+		select {
+		case e := <-events:
+			if e.Revision != 3 {
+				continue
+			}
+			assert.Equal(t, RevisionEvent{
+				Kind:         schema.GroupKind{Group: "apps", Kind: "Deployment"},
+				Namespace:    metav1.NamespaceDefault,
+				Name:         "demo",
+				Revision:     3,
+				RevisionName: "demo-c",
+			}, e)
+			return
+		case <-timeout:
+			t.Fatal("timeout waiting for the revision event")
+		}
+	}
+}
+
+func TestWatchRolloutStatus(t *testing.T) {
+	replicas := int32(1)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: metav1.NamespaceDefault, UID: "abcdef"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+			Template: testPodTemplate("nginx:1.1"),
+		},
+	}
+	oldRS := testReplicaSet("demo-a", 1, "nginx:1.0")
+	oldRS.Status = appsv1.ReplicaSetStatus{Replicas: 1, AvailableReplicas: 1}
+	newRS := testReplicaSet("demo-b", 2, "nginx:1.1")
+	newRS.Status = appsv1.ReplicaSetStatus{Replicas: 1, AvailableReplicas: 1}
+	kind := schema.GroupKind{Group: "apps", Kind: "Deployment"}
+
+	client := fake.NewSimpleClientset(deployment, oldRS, newRS)
+	var messages []string
+	err := WatchRolloutStatus(context.TODO(), client, kind, metav1.NamespaceDefault, "demo", time.Second, func(message string) {
+		messages = append(messages, message)
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.Equal(t, []string{`Waiting for deployment "demo" rollout to finish: 1 old replicas are pending termination...`}, messages)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	err = WatchRolloutStatus(ctx, client, kind, metav1.NamespaceDefault, "demo", wait.ForeverTestTimeout, nil)
+	assert.Equal(t, context.Canceled, err)
+
+	oldRS.Status = appsv1.ReplicaSetStatus{}
+	client = fake.NewSimpleClientset(deployment, oldRS, newRS)
+	messages = nil
+	err = WatchRolloutStatus(context.TODO(), client, kind, metav1.NamespaceDefault, "demo", wait.ForeverTestTimeout, func(message string) {
+		messages = append(messages, message)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`deployment "demo" successfully rolled out`}, messages)
+
+	deployment.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"}}
+	client = fake.NewSimpleClientset(deployment, oldRS, newRS)
+	err = WatchRolloutStatus(context.TODO(), client, kind, metav1.NamespaceDefault, "demo", wait.ForeverTestTimeout, nil)
+	assert.True(t, IsProgressDeadlineExceeded(err))
+
+	// the missing object fails without waiting for the timeout
+	start := time.Now()
+	err = WatchRolloutStatus(context.TODO(), client, schema.GroupKind{Group: "apps", Kind: "StatefulSet"}, metav1.NamespaceDefault, "demo", wait.ForeverTestTimeout, nil)
+	assert.True(t, apierrors.IsNotFound(err))
+	assert.EqualError(t, err, `statefulsets.apps "demo" not found`)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestPauseResumeRestart(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: metav1.NamespaceDefault},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+			Template: testPodTemplate("nginx:1.1"),
+		},
+	}
+	client := fake.NewSimpleClientset(deployment)
+	kind := schema.GroupKind{Group: "apps", Kind: "Deployment"}
+
+	assert.NotNil(t, ResumeDeployment(context.TODO(), client, metav1.NamespaceDefault, "demo"))
+	assert.Nil(t, PauseDeployment(context.TODO(), client, metav1.NamespaceDefault, "demo"))
+	assert.NotNil(t, PauseDeployment(context.TODO(), client, metav1.NamespaceDefault, "demo"))
+	assert.NotNil(t, Restart(context.TODO(), client, kind, metav1.NamespaceDefault, "demo"))
+	assert.Nil(t, ResumeDeployment(context.TODO(), client, metav1.NamespaceDefault, "demo"))
+	assert.Nil(t, Restart(context.TODO(), client, kind, metav1.NamespaceDefault, "demo"))
+
+	deployment, err := client.AppsV1().Deployments(metav1.NamespaceDefault).Get(context.TODO(), "demo", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.False(t, deployment.Spec.Paused)
+	assert.NotEmpty(t, deployment.Spec.Template.Annotations[RestartedAtAnnotation])
+}
+
+func TestRegisterControllerRevisionViewer(t *testing.T) {
+	kind := schema.GroupKind{Group: "apps.kruise.io", Kind: "CloneSet"}
+	gvr := schema.GroupVersionResource{Group: "apps.kruise.io", Version: "v1alpha1", Resource: "clonesets"}
+	cloneSet := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps.kruise.io/v1alpha1",
+		"kind":       "CloneSet",
+		"metadata": map[string]interface{}{
+			"name":      "demo",
+			"namespace": metav1.NamespaceDefault,
+			"uid":       "abcdef",
+		},
+		"spec": map[string]interface{}{
+			"selector":             map[string]interface{}{"matchLabels": map[string]interface{}{"app": "demo"}},
+			"revisionHistoryLimit": int64(5),
+		},
+		"status": map[string]interface{}{
+			"currentRevision": "demo-v1",
+			"updateRevision":  "demo-v2",
+		},
+	}}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "CloneSetList"}, cloneSet)
+	client := fake.NewSimpleClientset(
+		testControllerRevision("CloneSet", "demo", "v1", 1, "nginx:1.0"),
+		testControllerRevision("CloneSet", "demo", "v2", 2, "nginx:1.1"),
+		testPod("CloneSet", "demo", "demo-a", "demo-v2", true),
+	)
+
+	_, err := ViewerFor(client, kind)
+	assert.True(t, IsUnsupportedKind(err))
+
+	RegisterViewer(kind, func(c kubernetes.Interface, opts Options) Viewer {
+		return NewControllerRevisionViewer(dynamicClient, c, gvr, WithPageSize(opts.PageSize))
+	})
+	defer UnregisterViewer(kind)
+
+	viewer, err := ViewerFor(client, kind)
+	assert.Nil(t, err)
+	latest, olds, err := viewer.ViewHistory(context.TODO(), metav1.NamespaceDefault, "demo")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), latest[0].Revision)
+	assert.True(t, latest[0].UpdateRevision)
+	assert.Equal(t, []string{"nginx:1.1"}, latest[0].Images)
+	assert.Equal(t, int32(1), latest[0].Status.ReadyReplicas)
+	assert.Equal(t, int64(1), olds[0].Revision)
+	assert.True(t, olds[0].CurrentRevision)
+	assert.Equal(t, int32(5), olds[0].RevisionHistoryLimit)
+
+	differ, err := DifferFor(client, kind)
+	assert.Nil(t, err)
+	diff, err := differ.DiffRevisions(context.TODO(), metav1.NamespaceDefault, "demo", 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx:1.1", diff.Changes[0].To)
+}
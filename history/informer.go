@@ -0,0 +1,292 @@
+package history
+
+import (
+	"context"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// CachedViewerFor returns the Viewer of the kind which serves the history from the shared informers cache,
+// instead of getting and listing from the API server every time. It registers the informers to the factory,
+// so the caller must start the factory and wait for the cache synced after that.
+func CachedViewerFor(factory informers.SharedInformerFactory, kind schema.GroupKind) (Viewer, error) {
+	apps := factory.Apps().V1()
+	switch {
+	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "Deployment":
+		return &cachedDeploymentViewer{
+			deployments: apps.Deployments().Lister(),
+			replicaSets: apps.ReplicaSets().Lister(),
+		}, nil
+	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "StatefulSet":
+		return &cachedStatefulSetViewer{
+			statefulSets: apps.StatefulSets().Lister(),
+			revisions:    apps.ControllerRevisions().Lister(),
+			pods:         factory.Core().V1().Pods().Lister(),
+		}, nil
+	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "DaemonSet":
+		return &cachedDaemonSetViewer{
+			daemonSets: apps.DaemonSets().Lister(),
+			revisions:  apps.ControllerRevisions().Lister(),
+			pods:       factory.Core().V1().Pods().Lister(),
+		}, nil
+	}
+	return nil, &UnsupportedKindError{Kind: kind}
+}
+
+type cachedDeploymentViewer struct {
+	deployments appsv1listers.DeploymentLister
+	replicaSets appsv1listers.ReplicaSetLister
+}
+
+func (h *cachedDeploymentViewer) ViewHistory(ctx context.Context, namespace, name string) ([]*RevisionHistory, []*RevisionHistory, error) {
+	deployment, rsList, err := h.list(namespace, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return deploymentHistory(deployment, rsList)
+}
+
+func (h *cachedDeploymentViewer) DiffRevisions(ctx context.Context, namespace, name string, from, to int64) (*RevisionDiff, error) {
+	_, rsList, err := h.list(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return diffReplicaSets(rsList, from, to)
+}
+
+// list returns the copies of the Deployment and its ReplicaSets from the cache.
+func (h *cachedDeploymentViewer) list(namespace, name string) (*appsv1.Deployment, []*appsv1.ReplicaSet, error) {
+	deployment, err := h.deployments.Deployments(namespace).Get(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	list, err := h.replicaSets.ReplicaSets(namespace).List(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owned := make([]*appsv1.ReplicaSet, 0, len(list))
+	for _, rs := range list {
+		if metav1.IsControlledBy(rs, deployment) {
+			owned = append(owned, rs.DeepCopy())
+		}
+	}
+	return deployment.DeepCopy(), owned, nil
+}
+
+type cachedStatefulSetViewer struct {
+	statefulSets appsv1listers.StatefulSetLister
+	revisions    appsv1listers.ControllerRevisionLister
+	pods         corev1listers.PodLister
+}
+
+func (h *cachedStatefulSetViewer) ViewHistory(ctx context.Context, namespace, name string) ([]*RevisionHistory, []*RevisionHistory, error) {
+	sts, err := h.statefulSets.StatefulSets(namespace).Get(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revisions, pods, err := listCachedRevisions(h.revisions, h.pods, sts, sts.Spec.Selector, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	latest, olds := statefulSetHistory(sts.DeepCopy(), revisions, pods)
+	return latest, olds, nil
+}
+
+func (h *cachedStatefulSetViewer) DiffRevisions(ctx context.Context, namespace, name string, from, to int64) (*RevisionDiff, error) {
+	sts, err := h.statefulSets.StatefulSets(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, _, err := listCachedRevisions(h.revisions, h.pods, sts, sts.Spec.Selector, false)
+	if err != nil {
+		return nil, err
+	}
+	return diffControllerRevisions(revisions, from, to)
+}
+
+type cachedDaemonSetViewer struct {
+	daemonSets appsv1listers.DaemonSetLister
+	revisions  appsv1listers.ControllerRevisionLister
+	pods       corev1listers.PodLister
+}
+
+func (h *cachedDaemonSetViewer) ViewHistory(ctx context.Context, namespace, name string) ([]*RevisionHistory, []*RevisionHistory, error) {
+	ds, err := h.daemonSets.DaemonSets(namespace).Get(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revisions, pods, err := listCachedRevisions(h.revisions, h.pods, ds, ds.Spec.Selector, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	latest, olds := daemonSetHistory(ds.DeepCopy(), revisions, pods)
+	return latest, olds, nil
+}
+
+func (h *cachedDaemonSetViewer) DiffRevisions(ctx context.Context, namespace, name string, from, to int64) (*RevisionDiff, error) {
+	ds, err := h.daemonSets.DaemonSets(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, _, err := listCachedRevisions(h.revisions, h.pods, ds, ds.Spec.Selector, false)
+	if err != nil {
+		return nil, err
+	}
+	return diffControllerRevisions(revisions, from, to)
+}
+
+// listCachedRevisions returns the copies of the ControllerRevisions sorted by revision and the pods
+// owned by the owner from the cache, the pods are listed only if withPods is true.
+func listCachedRevisions(revisionLister appsv1listers.ControllerRevisionLister, podLister corev1listers.PodLister,
+	owner metav1.Object, labelSelector *metav1.LabelSelector, withPods bool) ([]*appsv1.ControllerRevision, []*corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	crList, err := revisionLister.ControllerRevisions(owner.GetNamespace()).List(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	revisions := make([]*appsv1.ControllerRevision, 0, len(crList))
+	for _, cr := range crList {
+		if metav1.IsControlledBy(cr, owner) {
+			revisions = append(revisions, cr.DeepCopy())
+		}
+	}
+	sort.Sort(controllerRevisionsByRevision(revisions))
+
+	if !withPods {
+		return revisions, nil, nil
+	}
+
+	podList, err := podLister.Pods(owner.GetNamespace()).List(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	pods := make([]*corev1.Pod, 0, len(podList))
+	for _, pod := range podList {
+		if metav1.IsControlledBy(pod, owner) {
+			pods = append(pods, pod)
+		}
+	}
+	return revisions, pods, nil
+}
+
+// RevisionEvent is the notification of a new revision of the workload.
+type RevisionEvent struct {
+	// Kind is the kind of the workload.
+	Kind schema.GroupKind
+	// Namespace and Name are the workload namespace and name.
+	Namespace string
+	Name      string
+	// Revision is the revision number, RevisionName is the ReplicaSet or ControllerRevision name of the revision.
+	Revision     int64
+	RevisionName string
+}
+
+// AddRevisionHandler calls the handler when a new revision of the Deployment, StatefulSet or DaemonSet appears,
+// including the revision bumped by rollback. It registers the ReplicaSets and ControllerRevisions informers
+// to the factory, the existing revisions are also notified when the informers sync.
+func AddRevisionHandler(factory informers.SharedInformerFactory, handler func(RevisionEvent)) {
+	factory.Apps().V1().ReplicaSets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if rs, ok := obj.(*appsv1.ReplicaSet); ok {
+				notifyReplicaSetRevision(rs, 0, handler)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldRS, ok := oldObj.(*appsv1.ReplicaSet)
+			if !ok {
+				return
+			}
+			if rs, ok := newObj.(*appsv1.ReplicaSet); ok {
+				oldRevision, _ := Revision(oldRS)
+				notifyReplicaSetRevision(rs, oldRevision, handler)
+			}
+		},
+	})
+
+	factory.Apps().V1().ControllerRevisions().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if cr, ok := obj.(*appsv1.ControllerRevision); ok {
+				notifyControllerRevision(cr, 0, handler)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldCR, ok := oldObj.(*appsv1.ControllerRevision)
+			if !ok {
+				return
+			}
+			if cr, ok := newObj.(*appsv1.ControllerRevision); ok {
+				notifyControllerRevision(cr, oldCR.Revision, handler)
+			}
+		},
+	})
+}
+
+// notifyReplicaSetRevision calls the handler if the ReplicaSet revision is changed from the oldRevision.
+func notifyReplicaSetRevision(rs *appsv1.ReplicaSet, oldRevision int64, handler func(RevisionEvent)) {
+	revision, err := Revision(rs)
+	if err != nil {
+		klog.Warningf("ReplicaSet %s/%s revision invalid, %v", rs.Namespace, rs.Name, err)
+		return
+	}
+	if revision == 0 || revision == oldRevision {
+		return
+	}
+
+	owner := metav1.GetControllerOf(rs)
+	if owner == nil || owner.Kind != "Deployment" {
+		return
+	}
+	handler(newRevisionEvent(owner, rs.Namespace, revision, rs.Name))
+}
+
+// notifyControllerRevision calls the handler if the ControllerRevision revision is changed from the oldRevision.
+func notifyControllerRevision(cr *appsv1.ControllerRevision, oldRevision int64, handler func(RevisionEvent)) {
+	if cr.Revision == oldRevision {
+		return
+	}
+
+	owner := metav1.GetControllerOf(cr)
+	if owner == nil {
+		return
+	}
+	handler(newRevisionEvent(owner, cr.Namespace, cr.Revision, cr.Name))
+}
+
+func newRevisionEvent(owner *metav1.OwnerReference, namespace string, revision int64, revisionName string) RevisionEvent {
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	if err != nil {
+		klog.Warningf("Owner %s apiVersion invalid, %v", owner.Name, err)
+	}
+	return RevisionEvent{
+		Kind:         schema.GroupKind{Group: gv.Group, Kind: owner.Kind},
+		Namespace:    namespace,
+		Name:         owner.Name,
+		Revision:     revision,
+		RevisionName: revisionName,
+	}
+}
@@ -1,25 +1,70 @@
 package history
 
 import (
+	"context"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	// ChangeCauseAnnotation is the annotation records the cause of the revision.
+	ChangeCauseAnnotation = "kubernetes.io/change-cause"
+
+	// DefaultRevisionHistoryLimit is the default revisionHistoryLimit of the workloads.
+	DefaultRevisionHistoryLimit int32 = 10
+
+	// DefaultPageSize is the default page size to list the ReplicaSets, ControllerRevisions and Pods.
+	DefaultPageSize int64 = 500
+)
+
+// Options is the options of the viewers and rollbackers.
+type Options struct {
+	// PageSize is the limit of each list request, 0 means list all in one request.
+	PageSize int64
+}
+
+type Option func(*Options)
+
+// WithPageSize sets the page size of the list requests.
+func WithPageSize(pageSize int64) Option {
+	return func(o *Options) {
+		o.PageSize = pageSize
+	}
+}
+
+func newOptions(opts ...Option) Options {
+	o := Options{PageSize: DefaultPageSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
 type Viewer interface {
-	ViewHistory(namespace, name string) ([]*RevisionHistory, []*RevisionHistory, error)
+	ViewHistory(ctx context.Context, namespace, name string) ([]*RevisionHistory, []*RevisionHistory, error)
 }
 
-func ViewerFor(c kubernetes.Interface, kind schema.GroupKind) Viewer {
+// ViewerFor returns the Viewer of the kind, it returns UnsupportedKindError if the kind has no history.
+// The viewers registered by RegisterViewer are looked up first.
+func ViewerFor(c kubernetes.Interface, kind schema.GroupKind, opts ...Option) (Viewer, error) {
+	o := newOptions(opts...)
+	if v := registeredViewerFor(c, kind, o); v != nil {
+		return v, nil
+	}
+
 	switch {
 	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "Deployment":
-		return &DeploymentViewer{c}
+		return &DeploymentViewer{c: c, pageSize: o.PageSize}, nil
 	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "StatefulSet":
-		return &StatefulSetViewer{c}
-	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "Daemonset":
-		return &DaemonsetViewer{c}
+		return &StatefulSetViewer{c: c, pageSize: o.PageSize}, nil
+	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "DaemonSet":
+		return &DaemonSetViewer{c: c, pageSize: o.PageSize}, nil
 	}
-	return nil
+	return nil, &UnsupportedKindError{Kind: kind}
 }
 
 func groupMatch(group string, matches ...string) bool {
@@ -39,6 +84,43 @@ type RevisionHistory struct {
 	CreateTimestamp metav1.Time       `json:"createTimestamp"`
 	Status          HistoryStatus     `json:"status"`
 	Images          []string          `json:"images"`
+	// CurrentRevision is true if the revision is the current revision of the workload.
+	CurrentRevision bool `json:"currentRevision"`
+	// UpdateRevision is true if the revision is the revision which the workload is updating to.
+	UpdateRevision bool `json:"updateRevision"`
+	// Template is the pod template of the revision.
+	Template corev1.PodTemplateSpec `json:"template"`
+	// ChangeCause is the kubernetes.io/change-cause annotation of the revision.
+	ChangeCause string `json:"changeCause,omitempty"`
+	// HistoryPosition is the position of the old revision counted from the newest old revision, starts from 1,
+	// and it's 0 for the latest revision. The old revision which position is greater than the RevisionHistoryLimit
+	// will be cleaned up by the controller.
+	HistoryPosition int `json:"historyPosition"`
+	// RevisionHistoryLimit is the revisionHistoryLimit of the workload.
+	RevisionHistoryLimit int32 `json:"revisionHistoryLimit"`
+}
+
+// setHistoryPositions sets the history position of the old revisions and the revision history limit of all revisions.
+func setHistoryPositions(latest, olds []*RevisionHistory, revisionHistoryLimit *int32) {
+	limit := DefaultRevisionHistoryLimit
+	if revisionHistoryLimit != nil {
+		limit = *revisionHistoryLimit
+	}
+
+	for _, rh := range latest {
+		rh.HistoryPosition = 0
+		rh.RevisionHistoryLimit = limit
+	}
+
+	sorted := make([]*RevisionHistory, len(olds))
+	copy(sorted, olds)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Revision > sorted[j].Revision
+	})
+	for i, rh := range sorted {
+		rh.HistoryPosition = i + 1
+		rh.RevisionHistoryLimit = limit
+	}
 }
 
 type HistoryStatus struct {
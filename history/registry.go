@@ -0,0 +1,47 @@
+package history
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ViewerFactory creates the Viewer of the registered kind.
+type ViewerFactory func(c kubernetes.Interface, opts Options) Viewer
+
+var (
+	registryLock sync.RWMutex
+	registry     = map[schema.GroupKind]ViewerFactory{}
+)
+
+// RegisterViewer registers the Viewer factory of the kind, e.g. Argo Rollout or OpenKruise CloneSet.
+// ViewerFor looks up the registered viewers before the built-in viewers, so it can also override them.
+//
+// For the workload saves its revisions in the ControllerRevisions:
+//
+//	history.RegisterViewer(schema.GroupKind{Group: "apps.kruise.io", Kind: "CloneSet"}, func(c kubernetes.Interface, opts history.Options) history.Viewer {
+//		return history.NewControllerRevisionViewer(dynamicClient, c, cloneSetGVR, history.WithPageSize(opts.PageSize))
+//	})
+func RegisterViewer(kind schema.GroupKind, factory ViewerFactory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry[kind] = factory
+}
+
+// UnregisterViewer removes the registered Viewer factory of the kind.
+func UnregisterViewer(kind schema.GroupKind) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	delete(registry, kind)
+}
+
+func registeredViewerFor(c kubernetes.Interface, kind schema.GroupKind, opts Options) Viewer {
+	registryLock.RLock()
+	factory, ok := registry[kind]
+	registryLock.RUnlock()
+	if !ok {
+		return nil
+	}
+	return factory(c, opts)
+}
@@ -0,0 +1,245 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// Rollbacker rolls the workload back to a revision, it's like `kubectl rollout undo`.
+type Rollbacker interface {
+	// Rollback rolls the workload back to toRevision, 0 means the previous revision. It returns the
+	// revision of the workload after rollback. If dryRun is true, the change is not persisted.
+	Rollback(ctx context.Context, namespace, name string, toRevision int64, dryRun bool) (int64, error)
+}
+
+// RollbackerFor returns the Rollbacker of the kind, it returns UnsupportedKindError if the kind can't rollback.
+func RollbackerFor(c kubernetes.Interface, kind schema.GroupKind, opts ...Option) (Rollbacker, error) {
+	o := newOptions(opts...)
+	switch {
+	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "Deployment":
+		return &DeploymentRollbacker{c: c, pageSize: o.PageSize}, nil
+	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "StatefulSet":
+		return &StatefulSetRollbacker{c: c, pageSize: o.PageSize}, nil
+	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "DaemonSet":
+		return &DaemonSetRollbacker{c: c, pageSize: o.PageSize}, nil
+	}
+	return nil, &UnsupportedKindError{Kind: kind}
+}
+
+// annotationsToSkip is the annotations of the ReplicaSet which aren't copied to the Deployment when rollback.
+var annotationsToSkip = map[string]bool{
+	corev1.LastAppliedConfigAnnotation:          true,
+	DeploymentRevisionAnnotation:                true,
+	"deployment.kubernetes.io/revision-history": true,
+	"deployment.kubernetes.io/desired-replicas": true,
+	"deployment.kubernetes.io/max-replicas":     true,
+	"deprecated.deployment.rollback.to":         true,
+}
+
+func patchOptions(dryRun bool) metav1.PatchOptions {
+	opts := metav1.PatchOptions{}
+	if dryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	return opts
+}
+
+type DeploymentRollbacker struct {
+	c        kubernetes.Interface
+	pageSize int64
+}
+
+func (r *DeploymentRollbacker) Rollback(ctx context.Context, namespace, name string, toRevision int64, dryRun bool) (int64, error) {
+	deployment, err := r.c.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	if deployment.Spec.Paused {
+		return 0, fmt.Errorf("you cannot rollback a paused deployment; resume it first and try again")
+	}
+
+	rsList, err := listReplicaSets(ctx, r.c.AppsV1(), deployment, r.pageSize)
+	if err != nil {
+		return 0, err
+	}
+
+	rs, maxRevision, err := findReplicaSetForRevision(rsList, toRevision)
+	if err != nil {
+		return 0, err
+	}
+	revision, _ := Revision(rs)
+
+	if equalIgnoreHash(&deployment.Spec.Template, &rs.Spec.Template) {
+		return 0, &RollbackSkippedError{Revision: revision}
+	}
+
+	// remove hash label before patching back into the deployment
+	template := replicaSetTemplate(rs)
+
+	annotations := map[string]string{}
+	for k := range annotationsToSkip {
+		if v, ok := deployment.Annotations[k]; ok {
+			annotations[k] = v
+		}
+	}
+	for k, v := range rs.Annotations {
+		if !annotationsToSkip[k] {
+			annotations[k] = v
+		}
+	}
+
+	patch, err := json.Marshal([]interface{}{
+		map[string]interface{}{"op": "replace", "path": "/spec/template", "value": template},
+		map[string]interface{}{"op": "replace", "path": "/metadata/annotations", "value": annotations},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	klog.V(2).Infof("Rollback deployment %s/%s to revision %d", namespace, name, revision)
+	if _, err := r.c.AppsV1().Deployments(namespace).Patch(ctx, name, types.JSONPatchType, patch, patchOptions(dryRun)); err != nil {
+		return 0, fmt.Errorf("failed restoring revision %d: %v", revision, err)
+	}
+	// the deployment controller bumps the revision of the rolled back ReplicaSet to the next revision
+	return maxRevision + 1, nil
+}
+
+// findReplicaSetForRevision returns the ReplicaSet of the revision and the max revision,
+// if toRevision is 0, returns the ReplicaSet of the previous revision.
+func findReplicaSetForRevision(rsList []*appsv1.ReplicaSet, toRevision int64) (*appsv1.ReplicaSet, int64, error) {
+	var (
+		maxRevision, previousRevision int64
+		maxRS, previousRS, toRS       *appsv1.ReplicaSet
+	)
+	for _, rs := range rsList {
+		v, err := Revision(rs)
+		if err != nil {
+			klog.Warningf("ReplicaSet %s revision invalid, %v", rs.Name, err)
+			continue
+		}
+		if toRevision > 0 && v == toRevision {
+			toRS = rs
+		}
+		if v > maxRevision {
+			previousRevision, previousRS = maxRevision, maxRS
+			maxRevision, maxRS = v, rs
+		} else if v > previousRevision {
+			previousRevision, previousRS = v, rs
+		}
+	}
+
+	if toRevision == 0 {
+		if previousRS == nil {
+			return nil, 0, &RevisionNotFoundError{}
+		}
+		return previousRS, maxRevision, nil
+	}
+	if toRS == nil {
+		return nil, 0, &RevisionNotFoundError{Revision: toRevision}
+	}
+	return toRS, maxRevision, nil
+}
+
+type StatefulSetRollbacker struct {
+	c        kubernetes.Interface
+	pageSize int64
+}
+
+func (r *StatefulSetRollbacker) Rollback(ctx context.Context, namespace, name string, toRevision int64, dryRun bool) (int64, error) {
+	sts, err := r.c.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	revisions, err := listControllerRevisions(ctx, r.c, sts.Namespace, sts.Spec.Selector, sts, r.pageSize)
+	if err != nil {
+		return 0, err
+	}
+
+	klog.V(2).Infof("Rollback statefulset %s/%s to revision %d", namespace, name, toRevision)
+	return rollbackControllerRevision(&sts.Spec.Template, revisions, toRevision, func(patch []byte) error {
+		_, err := r.c.AppsV1().StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, patchOptions(dryRun))
+		return err
+	})
+}
+
+type DaemonSetRollbacker struct {
+	c        kubernetes.Interface
+	pageSize int64
+}
+
+func (r *DaemonSetRollbacker) Rollback(ctx context.Context, namespace, name string, toRevision int64, dryRun bool) (int64, error) {
+	ds, err := r.c.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	revisions, err := listControllerRevisions(ctx, r.c, ds.Namespace, ds.Spec.Selector, ds, r.pageSize)
+	if err != nil {
+		return 0, err
+	}
+
+	klog.V(2).Infof("Rollback daemonset %s/%s to revision %d", namespace, name, toRevision)
+	return rollbackControllerRevision(&ds.Spec.Template, revisions, toRevision, func(patch []byte) error {
+		_, err := r.c.AppsV1().DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, patchOptions(dryRun))
+		return err
+	})
+}
+
+// rollbackControllerRevision patches the ControllerRevision data of toRevision to the workload,
+// the data is the strategic merge patch of the workload template.
+func rollbackControllerRevision(current *corev1.PodTemplateSpec, revisions []*appsv1.ControllerRevision, toRevision int64, patchFn func(patch []byte) error) (int64, error) {
+	cr, err := findControllerRevision(revisions, toRevision)
+	if err != nil {
+		return 0, err
+	}
+
+	template, err := controllerRevisionTemplate(cr)
+	if err != nil {
+		return 0, err
+	}
+	if apiequality.Semantic.DeepEqual(current, template) {
+		return 0, &RollbackSkippedError{Revision: cr.Revision}
+	}
+
+	patch := cr.Data.Raw
+	if len(patch) == 0 {
+		if patch, err = json.Marshal(cr.Data.Object); err != nil {
+			return 0, err
+		}
+	}
+	if err := patchFn(patch); err != nil {
+		return 0, fmt.Errorf("failed restoring revision %d: %v", cr.Revision, err)
+	}
+
+	// the controller bumps the revision of the rolled back ControllerRevision to the next revision
+	return revisions[len(revisions)-1].Revision + 1, nil
+}
+
+// findControllerRevision returns the ControllerRevision of the revision from the revisions sorted by revision,
+// if toRevision is 0, returns the previous revision.
+func findControllerRevision(revisions []*appsv1.ControllerRevision, toRevision int64) (*appsv1.ControllerRevision, error) {
+	if toRevision == 0 {
+		if len(revisions) <= 1 {
+			return nil, &RevisionNotFoundError{}
+		}
+		return revisions[len(revisions)-2], nil
+	}
+
+	for _, cr := range revisions {
+		if cr.Revision == toRevision {
+			return cr, nil
+		}
+	}
+	return nil, &RevisionNotFoundError{Revision: toRevision}
+}
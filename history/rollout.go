@@ -0,0 +1,97 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// RestartedAtAnnotation is the pod template annotation updated to restart the workload, the same as kubectl.
+const RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// PauseDeployment pauses the Deployment rollout, it's like `kubectl rollout pause`.
+func PauseDeployment(ctx context.Context, c kubernetes.Interface, namespace, name string) error {
+	return setDeploymentPaused(ctx, c, namespace, name, true)
+}
+
+// ResumeDeployment resumes the paused Deployment rollout, it's like `kubectl rollout resume`.
+func ResumeDeployment(ctx context.Context, c kubernetes.Interface, namespace, name string) error {
+	return setDeploymentPaused(ctx, c, namespace, name, false)
+}
+
+func setDeploymentPaused(ctx context.Context, c kubernetes.Interface, namespace, name string, paused bool) error {
+	deployment, err := c.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if deployment.Spec.Paused == paused {
+		if paused {
+			return fmt.Errorf("deployment %q is already paused", name)
+		}
+		return fmt.Errorf("deployment %q is not paused", name)
+	}
+
+	klog.V(2).Infof("Set deployment %s/%s paused %t", namespace, name, paused)
+	patch := fmt.Sprintf(`{"spec":{"paused":%t}}`, paused)
+	_, err = c.AppsV1().Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
+
+// Restart restarts the pods of the Deployment, StatefulSet or DaemonSet by updating the restartedAt annotation
+// of the pod template, it's like `kubectl rollout restart`.
+func Restart(ctx context.Context, c kubernetes.Interface, kind schema.GroupKind, namespace, name string) error {
+	apps := c.AppsV1()
+	var patchFn func(patch []byte) error
+
+	switch {
+	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "Deployment":
+		deployment, err := apps.Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if deployment.Spec.Paused {
+			return fmt.Errorf("can't restart paused deployment %q (resume it first)", name)
+		}
+		patchFn = func(patch []byte) error {
+			_, err := apps.Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+			return err
+		}
+	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "StatefulSet":
+		sts, err := apps.StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+			return fmt.Errorf("restart has no effect on statefulset %q with updateStrategy %s", name, appsv1.OnDeleteStatefulSetStrategyType)
+		}
+		patchFn = func(patch []byte) error {
+			_, err := apps.StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+			return err
+		}
+	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "DaemonSet":
+		ds, err := apps.DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if ds.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType {
+			return fmt.Errorf("restart has no effect on daemonset %q with updateStrategy %s", name, appsv1.OnDeleteDaemonSetStrategyType)
+		}
+		patchFn = func(patch []byte) error {
+			_, err := apps.DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+			return err
+		}
+	default:
+		return &UnsupportedKindError{Kind: kind}
+	}
+
+	klog.V(2).Infof("Restart %s %s/%s", kind.Kind, namespace, name)
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, RestartedAtAnnotation, time.Now().Format(time.RFC3339))
+	return patchFn([]byte(patch))
+}
@@ -0,0 +1,54 @@
+package history
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type StatefulSetViewer struct {
+	c        kubernetes.Interface
+	pageSize int64
+}
+
+// ViewHistory returns the update revision as the latest revision, and the other ControllerRevisions
+// owned by the StatefulSet as the old revisions.
+func (h *StatefulSetViewer) ViewHistory(ctx context.Context, namespace, name string) ([]*RevisionHistory, []*RevisionHistory, error) {
+	sts, err := h.c.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revisions, err := listControllerRevisions(ctx, h.c, sts.Namespace, sts.Spec.Selector, sts, h.pageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pods, err := listPods(ctx, h.c, sts.Namespace, sts.Spec.Selector, sts, h.pageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	latest, olds := statefulSetHistory(sts, revisions, pods)
+	return latest, olds, nil
+}
+
+func statefulSetHistory(sts *appsv1.StatefulSet, revisions []*appsv1.ControllerRevision, pods []*corev1.Pod) ([]*RevisionHistory, []*RevisionHistory) {
+	return controllerRevisionHistory(revisions, pods, sts.Spec.MinReadySeconds, sts.Status.CurrentRevision, sts.Status.UpdateRevision, sts.Spec.RevisionHistoryLimit)
+}
+
+func (h *StatefulSetViewer) DiffRevisions(ctx context.Context, namespace, name string, from, to int64) (*RevisionDiff, error) {
+	sts, err := h.c.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := listControllerRevisions(ctx, h.c, sts.Namespace, sts.Spec.Selector, sts, h.pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return diffControllerRevisions(revisions, from, to)
+}
@@ -0,0 +1,228 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+	"k8s.io/klog/v2"
+)
+
+// statusFunc returns the rollout status message of the object, and done is true if the rollout is complete.
+type statusFunc func(ctx context.Context, obj runtime.Object) (string, bool, error)
+
+// WatchRolloutStatus watches the Deployment, StatefulSet or DaemonSet and calls progress with the rollout
+// status message when it changes, until the rollout is complete. It's like `kubectl rollout status`.
+// It fails if the Deployment exceeded its progress deadline, or the rollout is not complete within the timeout,
+// the timeout 0 means no timeout. If the ctx is done first, the ctx error is returned. The NotFound error is
+// returned at once if the object doesn't exist.
+func WatchRolloutStatus(ctx context.Context, c kubernetes.Interface, kind schema.GroupKind, namespace, name string, timeout time.Duration, progress func(message string)) error {
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+
+	var (
+		lw       *cache.ListWatch
+		objType  runtime.Object
+		resource string
+		status   statusFunc
+	)
+	apps := c.AppsV1()
+	switch {
+	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "Deployment":
+		lw = &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.FieldSelector = fieldSelector
+				return apps.Deployments(namespace).List(ctx, options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.FieldSelector = fieldSelector
+				return apps.Deployments(namespace).Watch(ctx, options)
+			},
+		}
+		objType = &appsv1.Deployment{}
+		resource = "deployments"
+		status = func(ctx context.Context, obj runtime.Object) (string, bool, error) {
+			return deploymentRolloutStatus(ctx, c, obj.(*appsv1.Deployment))
+		}
+	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "StatefulSet":
+		lw = &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.FieldSelector = fieldSelector
+				return apps.StatefulSets(namespace).List(ctx, options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.FieldSelector = fieldSelector
+				return apps.StatefulSets(namespace).Watch(ctx, options)
+			},
+		}
+		objType = &appsv1.StatefulSet{}
+		resource = "statefulsets"
+		status = func(_ context.Context, obj runtime.Object) (string, bool, error) {
+			return statefulSetRolloutStatus(obj.(*appsv1.StatefulSet))
+		}
+	case groupMatch(kind.Group, "apps", "extensions") && kind.Kind == "DaemonSet":
+		lw = &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.FieldSelector = fieldSelector
+				return apps.DaemonSets(namespace).List(ctx, options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.FieldSelector = fieldSelector
+				return apps.DaemonSets(namespace).Watch(ctx, options)
+			},
+		}
+		objType = &appsv1.DaemonSet{}
+		resource = "daemonsets"
+		status = func(_ context.Context, obj runtime.Object) (string, bool, error) {
+			return daemonSetRolloutStatus(obj.(*appsv1.DaemonSet))
+		}
+	default:
+		return &UnsupportedKindError{Kind: kind}
+	}
+
+	watchCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		watchCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// fail fast if the object doesn't exist, instead of waiting for it until the timeout
+	precondition := func(store cache.Store) (bool, error) {
+		_, exists, err := store.Get(&metav1.ObjectMeta{Namespace: namespace, Name: name})
+		if err != nil {
+			return true, err
+		}
+		if !exists {
+			return true, apierrors.NewNotFound(schema.GroupResource{Group: "apps", Resource: resource}, name)
+		}
+		return false, nil
+	}
+
+	var lastMessage string
+	_, err := watchtools.UntilWithSync(watchCtx, lw, objType, precondition, func(e watch.Event) (bool, error) {
+		switch e.Type {
+		case watch.Deleted:
+			return false, fmt.Errorf("%s %s/%s has been deleted", kind.Kind, namespace, name)
+		case watch.Added, watch.Modified:
+			message, done, err := status(watchCtx, e.Object)
+			if err != nil {
+				return false, err
+			}
+			if message != lastMessage {
+				lastMessage = message
+				if progress != nil {
+					progress(message)
+				}
+			}
+			return done, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		// UntilWithSync returns ErrWaitTimeout or the cache sync error when the ctx is cancelled too
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if watchCtx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out waiting for the rollout of %s %s/%s", kind.Kind, namespace, name)
+		}
+	}
+	return err
+}
+
+// deploymentRolloutStatus returns the rollout status of the Deployment from its new and old ReplicaSets.
+func deploymentRolloutStatus(ctx context.Context, c kubernetes.Interface, deployment *appsv1.Deployment) (string, bool, error) {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return "Waiting for deployment spec update to be observed...", false, nil
+	}
+
+	for _, cond := range deployment.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return "", false, &ProgressDeadlineExceededError{Name: deployment.Name}
+		}
+	}
+
+	rsList, err := listReplicaSets(ctx, c.AppsV1(), deployment, DefaultPageSize)
+	if err != nil {
+		return "", false, err
+	}
+	newRS := findNewReplicaSet(deployment, rsList)
+	oldRSs := findOldReplicaSets(rsList, newRS)
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	var updatedReplicas, availableReplicas, oldReplicas int32
+	if newRS != nil {
+		updatedReplicas = newRS.Status.Replicas
+		availableReplicas = newRS.Status.AvailableReplicas
+	}
+	for _, rs := range oldRSs {
+		oldReplicas += rs.Status.Replicas
+	}
+
+	klog.V(5).Infof("Deployment %s updated replicas %d, available replicas %d, old replicas %d", deployment.Name, updatedReplicas, availableReplicas, oldReplicas)
+	switch {
+	case updatedReplicas < replicas:
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d out of %d new replicas have been updated...", deployment.Name, updatedReplicas, replicas), false, nil
+	case oldReplicas > 0:
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d old replicas are pending termination...", deployment.Name, oldReplicas), false, nil
+	case availableReplicas < updatedReplicas:
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d of %d updated replicas are available...", deployment.Name, availableReplicas, updatedReplicas), false, nil
+	}
+	return fmt.Sprintf("deployment %q successfully rolled out", deployment.Name), true, nil
+}
+
+func statefulSetRolloutStatus(sts *appsv1.StatefulSet) (string, bool, error) {
+	if sts.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		return "", false, fmt.Errorf("rollout status is only available for %s strategy type", appsv1.RollingUpdateStatefulSetStrategyType)
+	}
+	if sts.Status.ObservedGeneration == 0 || sts.Generation > sts.Status.ObservedGeneration {
+		return "Waiting for statefulset spec update to be observed...", false, nil
+	}
+	if sts.Spec.Replicas != nil && sts.Status.ReadyReplicas < *sts.Spec.Replicas {
+		return fmt.Sprintf("Waiting for %d pods to be ready...", *sts.Spec.Replicas-sts.Status.ReadyReplicas), false, nil
+	}
+
+	if rollingUpdate := sts.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.Partition != nil && *rollingUpdate.Partition > 0 {
+		if sts.Spec.Replicas != nil && sts.Status.UpdatedReplicas < (*sts.Spec.Replicas-*rollingUpdate.Partition) {
+			return fmt.Sprintf("Waiting for partitioned roll out to finish: %d out of %d new pods have been updated...",
+				sts.Status.UpdatedReplicas, *sts.Spec.Replicas-*rollingUpdate.Partition), false, nil
+		}
+		return fmt.Sprintf("partitioned roll out complete: %d new pods have been updated...", sts.Status.UpdatedReplicas), true, nil
+	}
+
+	if sts.Status.UpdateRevision != sts.Status.CurrentRevision {
+		return fmt.Sprintf("waiting for statefulset rolling update to complete %d pods at revision %s...", sts.Status.UpdatedReplicas, sts.Status.UpdateRevision), false, nil
+	}
+	return fmt.Sprintf("statefulset rolling update complete %d pods at revision %s...", sts.Status.CurrentReplicas, sts.Status.CurrentRevision), true, nil
+}
+
+func daemonSetRolloutStatus(ds *appsv1.DaemonSet) (string, bool, error) {
+	if ds.Spec.UpdateStrategy.Type != appsv1.RollingUpdateDaemonSetStrategyType {
+		return "", false, fmt.Errorf("rollout status is only available for %s strategy type", appsv1.RollingUpdateDaemonSetStrategyType)
+	}
+	if ds.Generation > ds.Status.ObservedGeneration {
+		return "Waiting for daemon set spec update to be observed...", false, nil
+	}
+
+	switch {
+	case ds.Status.UpdatedNumberScheduled < ds.Status.DesiredNumberScheduled:
+		return fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d out of %d new pods have been updated...", ds.Name, ds.Status.UpdatedNumberScheduled, ds.Status.DesiredNumberScheduled), false, nil
+	case ds.Status.NumberAvailable < ds.Status.DesiredNumberScheduled:
+		return fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d of %d updated pods are available...", ds.Name, ds.Status.NumberAvailable, ds.Status.DesiredNumberScheduled), false, nil
+	}
+	return fmt.Sprintf("daemon set %q successfully rolled out", ds.Name), true, nil
+}
@@ -225,3 +225,18 @@ func GetPodReadyContainers(pod *corev1.Pod) []string {
 	}
 	return containers
 }
+
+// IsPodAvailable returns true if the pod is ready for at least minReadySeconds.
+func IsPodAvailable(pod *corev1.Pod, minReadySeconds int32, now metav1.Time) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type != corev1.PodReady || c.Status != corev1.ConditionTrue {
+			continue
+		}
+		if minReadySeconds == 0 {
+			return true
+		}
+		minReadySecondsDuration := time.Duration(minReadySeconds) * time.Second
+		return !c.LastTransitionTime.IsZero() && c.LastTransitionTime.Add(minReadySecondsDuration).Before(now.Time)
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package terminal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// AccessDeniedError is returned when the user isn't allowed to exec, attach or debug the pod.
+type AccessDeniedError struct {
+	User        string
+	Verb        string
+	Namespace   string
+	Pod         string
+	Subresource string
+	Reason      string
+}
+
+func (e *AccessDeniedError) Error() string {
+	user := e.User
+	if user == "" {
+		user = "current user"
+	}
+	msg := fmt.Sprintf("%s is not allowed to %s pods/%s in pod %s/%s", user, e.Verb, e.Subresource, e.Namespace, e.Pod)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// IsAccessDenied returns true if the err is AccessDeniedError.
+func IsAccessDenied(err error) bool {
+	var e *AccessDeniedError
+	return errors.As(err, &e)
+}
+
+// impersonatedConfig returns the copy of the config which impersonates the user.
+func impersonatedConfig(config *rest.Config, impersonate rest.ImpersonationConfig) *rest.Config {
+	c := rest.CopyConfig(config)
+	c.Impersonate = impersonate
+	return c
+}
+
+// CheckPodAccess checks the user of the config is allowed to the verb of the pods subresource, such as create
+// the exec and attach, by the SelfSubjectAccessReview. It returns the AccessDeniedError if it's not allowed.
+func CheckPodAccess(ctx context.Context, config *rest.Config, verb, namespace, podName, subresource string) error {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	return checkPodAccess(ctx, client, config.Impersonate.UserName, verb, namespace, podName, subresource)
+}
+
+func checkPodAccess(ctx context.Context, c kubernetes.Interface, user, verb, namespace, podName, subresource string) error {
+	review, err := c.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        verb,
+				Resource:    "pods",
+				Subresource: subresource,
+				Name:        podName,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("check %s pods/%s access of pod %s/%s error, %v", verb, subresource, namespace, podName, err)
+	}
+
+	if !review.Status.Allowed {
+		return &AccessDeniedError{
+			User:        user,
+			Verb:        verb,
+			Namespace:   namespace,
+			Pod:         podName,
+			Subresource: subresource,
+			Reason:      review.Status.Reason,
+		}
+	}
+	return nil
+}
+
+// impersonate returns the config which impersonates the opts.Impersonate user, and checks the user is allowed
+// to stream the pods subresource. The config is returned as is if the opts.Impersonate is nil.
+//
+// The websocket executor opens the stream by the GET which is authorized as the get verb, the SPDY executor
+// opens it by the POST which is authorized as the create verb, the verb is checked as the executor does.
+func impersonate(ctx context.Context, config *rest.Config, namespace, podName, subresource string, opts *ExecOptions) (*rest.Config, error) {
+	if opts.Impersonate == nil {
+		return config, nil
+	}
+
+	verb := "create"
+	if opts.websocketExecutor() {
+		verb = "get"
+	}
+	config = impersonatedConfig(config, *opts.Impersonate)
+	if err := CheckPodAccess(ctx, config, verb, namespace, podName, subresource); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -0,0 +1,115 @@
+package terminal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCheckPodAccess(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		assert.Equal(t, "pods", attrs.Resource)
+		review.Status.Allowed = attrs.Verb == "create" && attrs.Subresource == "exec" && attrs.Name == "demo"
+		if !review.Status.Allowed {
+			review.Status.Reason = "RBAC: no rule"
+		}
+		return true, review, nil
+	})
+
+	assert.Nil(t, checkPodAccess(context.TODO(), client, "alice", "create", "default", "demo", "exec"))
+
+	err := checkPodAccess(context.TODO(), client, "alice", "create", "default", "demo", "attach")
+	assert.True(t, IsAccessDenied(err))
+	assert.EqualError(t, err, "alice is not allowed to create pods/attach in pod default/demo: RBAC: no rule")
+
+	err = checkPodAccess(context.TODO(), client, "alice", "update", "default", "demo", "ephemeralcontainers")
+	assert.EqualError(t, err, "alice is not allowed to update pods/ephemeralcontainers in pod default/demo: RBAC: no rule")
+}
+
+// newAccessReviewServer returns the apiserver which denies all SelfSubjectAccessReviews of the impersonated user,
+// the reviewed attributes are sent to the reviews channel.
+func newAccessReviewServer(t *testing.T, reviews chan<- authorizationv1.ResourceAttributes) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		assert.Equal(t, "alice", r.Header.Get("Impersonate-User"))
+
+		var review authorizationv1.SelfSubjectAccessReview
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&review))
+		reviews <- *review.Spec.ResourceAttributes
+		review.Status.Reason = "RBAC: no rule"
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(review)
+	}))
+}
+
+func TestAccessCheckedFirst(t *testing.T) {
+	reviews := make(chan authorizationv1.ResourceAttributes, 1)
+	server := newAccessReviewServer(t, reviews)
+	defer server.Close()
+
+	client := fake.NewSimpleClientset()
+	ts := &TerminalSession{client: client}
+	config := &rest.Config{Host: server.URL}
+	impersonate := &rest.ImpersonationConfig{UserName: "alice"}
+
+	err := ts.Attach(context.TODO(), config, "default", "demo", "app", &ExecOptions{Stdout: true, Impersonate: impersonate})
+	assert.True(t, IsAccessDenied(err))
+	attrs := <-reviews
+	assert.Equal(t, "create", attrs.Verb)
+	assert.Equal(t, "attach", attrs.Subresource)
+
+	// the websocket executor opens the stream by the GET
+	err = ts.Attach(context.TODO(), config, "default", "demo", "app", &ExecOptions{Stdin: true, Stdout: true, TTY: true, Impersonate: impersonate})
+	assert.True(t, IsAccessDenied(err))
+	attrs = <-reviews
+	assert.Equal(t, "get", attrs.Verb)
+	assert.Equal(t, "attach", attrs.Subresource)
+
+	err = ts.Exec(context.TODO(), config, "default", "demo", "app", []string{"sh"}, &ExecOptions{Stdout: true, Impersonate: impersonate})
+	assert.EqualError(t, err, "alice is not allowed to create pods/exec in pod default/demo: RBAC: no rule")
+	<-reviews
+
+	// the access check is canceled with the ctx of the caller
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	err = ts.Exec(ctx, config, "default", "demo", "app", []string{"sh"}, &ExecOptions{Stdout: true, Impersonate: impersonate})
+	assert.Contains(t, err.Error(), context.Canceled.Error())
+	assert.False(t, IsAccessDenied(err))
+
+	err = ts.Debug(context.TODO(), config, "default", "demo", &DebugOptions{
+		Image:         "busybox",
+		AttachOptions: &ExecOptions{Stdin: true, Stdout: true, TTY: true, Impersonate: impersonate},
+	})
+	assert.EqualError(t, err, "alice is not allowed to update pods/ephemeralcontainers in pod default/demo: RBAC: no rule")
+	attrs = <-reviews
+	assert.Equal(t, "update", attrs.Verb)
+	assert.Equal(t, "ephemeralcontainers", attrs.Subresource)
+
+	// the pod isn't read or updated by the session client
+	assert.Empty(t, client.Actions())
+}
+
+func TestImpersonatedConfig(t *testing.T) {
+	config := &rest.Config{Host: "https://localhost:6443", BearerToken: "token"}
+	c := impersonatedConfig(config, rest.ImpersonationConfig{UserName: "alice", Groups: []string{"dev"}})
+	assert.Equal(t, "alice", c.Impersonate.UserName)
+	assert.Equal(t, []string{"dev"}, c.Impersonate.Groups)
+	assert.Equal(t, "token", c.BearerToken)
+	assert.Empty(t, config.Impersonate.UserName)
+}
@@ -0,0 +1,392 @@
+package terminal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pytimer/k8sutil/wsremotecommand"
+)
+
+// cancelLine is sent to the container instead of the enter key when the command is denied,
+// the shell discards the typed line.
+const cancelLine = "\x03"
+
+// AuditEvent is the command line entered by the user in the terminal session.
+type AuditEvent struct {
+	Time      time.Time
+	User      string
+	Namespace string
+	Pod       string
+	Container string
+	Command   string
+	// Incomplete is true if the shell history, completion or the editing keys unknown to the auditor
+	// were used, the Command may differ from the command run by the shell.
+	Incomplete bool
+	// Denied is true if the command is rejected by the policy, and Reason is the rejected reason.
+	Denied bool
+	Reason string
+}
+
+// CommandPolicy decides whether the command is allowed to run in the container.
+type CommandPolicy interface {
+	// Check returns error if the command is not allowed.
+	Check(event AuditEvent) error
+}
+
+// CommandDeniedError is returned by the DenyPolicy if the command matches the deny pattern.
+type CommandDeniedError struct {
+	Command string
+	Pattern string
+}
+
+func (e *CommandDeniedError) Error() string {
+	return fmt.Sprintf("command %q is denied by the policy %q", e.Command, e.Pattern)
+}
+
+// IncompleteCommandError is returned if the command line can't be reconstructed when the policy is set,
+// see CommandAuditor.
+type IncompleteCommandError struct {
+	Command string
+}
+
+func (e *IncompleteCommandError) Error() string {
+	return fmt.Sprintf("command %q is denied, the history, completion or editing keys can't be audited, type the whole command", e.Command)
+}
+
+// DenyPolicy denies the commands which match any of the regular expressions.
+type DenyPolicy struct {
+	patterns []*regexp.Regexp
+}
+
+var _ CommandPolicy = &DenyPolicy{}
+
+func NewDenyPolicy(patterns ...string) (*DenyPolicy, error) {
+	p := &DenyPolicy{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q, %v", pattern, err)
+		}
+		p.patterns = append(p.patterns, re)
+	}
+	return p, nil
+}
+
+func (p *DenyPolicy) Check(event AuditEvent) error {
+	for _, re := range p.patterns {
+		if re.MatchString(event.Command) {
+			return &CommandDeniedError{Command: event.Command, Pattern: re.String()}
+		}
+	}
+	return nil
+}
+
+// CommandAuditor reconstructs the command lines from the stdin of the terminal session,
+// emits the audit events, and rejects the commands denied by the policy before they reach the container.
+//
+// The command line is assembled from the keystrokes, the line editing keys (backspace, delete,
+// left/right arrows, home/end, ctrl-u/k/w) are applied, and the lines continued by the backslash
+// are joined. The shell history and completion are unknown to the auditor, the line is marked
+// Incomplete after the up/down arrows, tab, ctrl-r or the escape sequences the auditor can't apply.
+// When the policy is set, the incomplete line is denied, so the policy can't be bypassed by recalling
+// or completing the command, the user has to type the whole command instead. The other control keys,
+// such as ctrl-o and ctrl-x which may run or edit the line without the enter key, are dropped when
+// the policy is set.
+//
+// The auditing is best-effort, it sees the keystrokes only, the commands run by the scripts,
+// the aliases and the programs reading the stdin (such as an editor) are not audited.
+type CommandAuditor struct {
+	user    string
+	policy  CommandPolicy
+	handler func(AuditEvent)
+}
+
+func NewCommandAuditor(user string) *CommandAuditor {
+	return &CommandAuditor{user: user}
+}
+
+// WithPolicy rejects the commands which the policy denies.
+func (a *CommandAuditor) WithPolicy(policy CommandPolicy) *CommandAuditor {
+	a.policy = policy
+	return a
+}
+
+// WithHandler calls the handler for every entered command line.
+func (a *CommandAuditor) WithHandler(handler func(AuditEvent)) *CommandAuditor {
+	a.handler = handler
+	return a
+}
+
+// interceptorFor returns the stdin interceptor of the container.
+func (a *CommandAuditor) interceptorFor(namespace, pod, container string) *commandInterceptor {
+	return &commandInterceptor{
+		auditor:   a,
+		namespace: namespace,
+		pod:       pod,
+		container: container,
+	}
+}
+
+type commandInterceptor struct {
+	auditor   *CommandAuditor
+	namespace string
+	pod       string
+	container string
+
+	mu   sync.Mutex
+	line lineAssembler
+}
+
+var _ wsremotecommand.StdinInterceptor = &commandInterceptor{}
+
+// Intercept feeds the stdin data to the line assembler, the enter key of the denied command is replaced
+// by the cancelLine, and the denied reason is returned as the reply.
+func (i *commandInterceptor) Intercept(data []byte) ([]byte, []byte) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	out := make([]byte, 0, len(data))
+	var reply []byte
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		key := data[:size]
+		data = data[size:]
+
+		line, known := i.line.feed(r)
+		if !known && i.auditor.policy != nil {
+			continue
+		}
+		if line != nil {
+			if err := i.audit(line); err != nil {
+				key = []byte(cancelLine)
+				reply = append(reply, "\r\n"+err.Error()+"\r\n"...)
+			}
+		}
+		out = append(out, key...)
+	}
+	return out, reply
+}
+
+// audit emits the audit event of the command line, and returns error if the command is denied.
+func (i *commandInterceptor) audit(line *enteredLine) error {
+	command := strings.TrimSpace(line.text)
+	if command == "" && !line.incomplete {
+		return nil
+	}
+
+	event := AuditEvent{
+		Time:       time.Now(),
+		User:       i.auditor.user,
+		Namespace:  i.namespace,
+		Pod:        i.pod,
+		Container:  i.container,
+		Command:    command,
+		Incomplete: line.incomplete,
+	}
+
+	var err error
+	if i.auditor.policy != nil {
+		if line.incomplete {
+			err = &IncompleteCommandError{Command: command}
+		} else {
+			err = i.auditor.policy.Check(event)
+		}
+	}
+	if err != nil {
+		event.Denied = true
+		event.Reason = err.Error()
+	}
+
+	if i.auditor.handler != nil {
+		i.auditor.handler(event)
+	}
+	return err
+}
+
+type escapeState int
+
+const (
+	escapeNone escapeState = iota
+	// escapeStart after the ESC
+	escapeStart
+	// escapeCSI after the ESC [
+	escapeCSI
+	// escapeSS3 after the ESC O
+	escapeSS3
+)
+
+// lineAssembler reconstructs the command line from the keystrokes.
+type lineAssembler struct {
+	buf    []rune
+	cursor int
+	state  escapeState
+	params []rune
+	// continued is the text of the previous lines continued by the backslash
+	continued string
+	// incomplete is true if the keys the assembler can't apply are pressed
+	incomplete bool
+}
+
+// enteredLine is the command line when the enter key is pressed.
+type enteredLine struct {
+	text       string
+	incomplete bool
+}
+
+// feed applies the key to the line, and returns the line when the enter key is pressed. The known
+// is false if the key is a control key which the assembler doesn't know how the shell handles.
+func (l *lineAssembler) feed(r rune) (line *enteredLine, known bool) {
+	switch l.state {
+	case escapeStart:
+		switch {
+		case r == '[':
+			l.state = escapeCSI
+			l.params = l.params[:0]
+			return nil, true
+		case r == 'O':
+			l.state = escapeSS3
+			return nil, true
+		case r >= 0x20:
+			// the alt key sequences, such as alt-. inserts the last argument
+			l.state = escapeNone
+			l.incomplete = true
+			return nil, true
+		}
+		// the control key after the ESC is applied as is, such as the enter key
+		l.state = escapeNone
+		l.incomplete = true
+	case escapeCSI:
+		// the final byte of the control sequence is in the range 0x40–0x7E
+		if r < 0x40 || r > 0x7e {
+			l.params = append(l.params, r)
+			return nil, true
+		}
+		l.state = escapeNone
+		l.escape(r, string(l.params))
+		return nil, true
+	case escapeSS3:
+		l.state = escapeNone
+		l.escape(r, "")
+		return nil, true
+	}
+
+	switch r {
+	case '\r', '\n':
+		text := l.continued + string(l.buf)
+		if n := len(l.buf); n > 0 && l.buf[n-1] == '\\' && !escaped(l.buf[:n-1]) {
+			// the shell joins the line continued by the backslash with the next line
+			l.continued = text[:len(text)-1]
+			l.buf = l.buf[:0]
+			l.cursor = 0
+			return nil, true
+		}
+		line := &enteredLine{text: text, incomplete: l.incomplete}
+		l.reset()
+		return line, true
+	case '\x1b':
+		l.state = escapeStart
+	case '\x7f', '\b':
+		if l.cursor > 0 {
+			l.buf = append(l.buf[:l.cursor-1], l.buf[l.cursor:]...)
+			l.cursor--
+		}
+	case '\x01': // ctrl-a
+		l.cursor = 0
+	case '\x05': // ctrl-e
+		l.cursor = len(l.buf)
+	case '\x03': // ctrl-c
+		l.reset()
+	case '\x04': // ctrl-d
+		// the shell exits on the empty line, otherwise deletes the character under the cursor
+		if len(l.buf) == 0 {
+			l.reset()
+		} else if l.cursor < len(l.buf) {
+			l.buf = append(l.buf[:l.cursor], l.buf[l.cursor+1:]...)
+		}
+	case '\x0c': // ctrl-l clears the screen
+	case '\x15': // ctrl-u
+		l.buf = l.buf[l.cursor:]
+		l.cursor = 0
+	case '\x0b': // ctrl-k
+		l.buf = l.buf[:l.cursor]
+	case '\x17': // ctrl-w
+		start := l.cursor
+		for start > 0 && l.buf[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && l.buf[start-1] != ' ' {
+			start--
+		}
+		l.buf = append(l.buf[:start], l.buf[l.cursor:]...)
+		l.cursor = start
+	case '\t', '\x12', '\x13', '\x10', '\x0e', '\x19', '\x1f':
+		// the tab completion, ctrl-r/s history search, ctrl-p/n history, ctrl-y yank and ctrl-_ undo
+		// edit the line only, the enter key is still required to run it
+		l.incomplete = true
+	default:
+		if r < 0x20 {
+			// ctrl-o runs the line, ctrl-x ctrl-e edits and runs it in the editor, ctrl-v inserts
+			// the next key literally, and the other keys unknown to the assembler
+			l.incomplete = true
+			return nil, false
+		}
+		if r == utf8.RuneError {
+			l.incomplete = true
+			return nil, true
+		}
+		l.buf = append(l.buf[:l.cursor], append([]rune{r}, l.buf[l.cursor:]...)...)
+		l.cursor++
+	}
+	return nil, true
+}
+
+// escaped returns true if the text ends with the odd number of backslashes, the next character is escaped.
+func escaped(text []rune) bool {
+	n := 0
+	for i := len(text) - 1; i >= 0 && text[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// escape applies the cursor movement and delete keys, the other keys make the line incomplete.
+func (l *lineAssembler) escape(final rune, params string) {
+	switch {
+	case final == 'C' && params == "":
+		if l.cursor < len(l.buf) {
+			l.cursor++
+		}
+	case final == 'D' && params == "":
+		if l.cursor > 0 {
+			l.cursor--
+		}
+	case final == 'H' && params == "":
+		l.cursor = 0
+	case final == 'F' && params == "":
+		l.cursor = len(l.buf)
+	case final == '~' && (params == "1" || params == "7"):
+		l.cursor = 0
+	case final == '~' && (params == "4" || params == "8"):
+		l.cursor = len(l.buf)
+	case final == '~' && params == "3":
+		if l.cursor < len(l.buf) {
+			l.buf = append(l.buf[:l.cursor], l.buf[l.cursor+1:]...)
+		}
+	case final == '~' && (params == "200" || params == "201"):
+		// the bracketed paste, the pasted text is applied as typed
+	default:
+		// the up/down arrows, the word movements with modifiers and the unknown keys
+		l.incomplete = true
+	}
+}
+
+func (l *lineAssembler) reset() {
+	l.buf = l.buf[:0]
+	l.cursor = 0
+	l.continued = ""
+	l.incomplete = false
+}
@@ -0,0 +1,142 @@
+package terminal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandInterceptor(t *testing.T) {
+	policy, err := NewDenyPolicy(`^rm\s+-rf\s+/`, `\bshutdown\b`)
+	assert.Nil(t, err)
+
+	var events []AuditEvent
+	auditor := NewCommandAuditor("alice").WithPolicy(policy).WithHandler(func(e AuditEvent) {
+		events = append(events, e)
+	})
+	i := auditor.interceptorFor("default", "demo", "nginx")
+
+	tests := []struct {
+		input  string
+		output string
+		denied bool
+	}{
+		{input: "ls -l\r", output: "ls -l\r"},
+		// backspace and left arrow
+		{input: "cay\x7f\x7fat fle\x1b[D\x1b[Di\r", output: "cay\x7f\x7fat fle\x1b[D\x1b[Di\r"},
+		{input: "rm -rf /\r", output: "rm -rf /\x03", denied: true},
+		{input: "echo ok\x1b[H\x1b[3~\x1b[3~\x1b[3~\x1b[3~shutdown\r", output: "echo ok\x1b[H\x1b[3~\x1b[3~\x1b[3~\x1b[3~shutdown\x03", denied: true},
+		{input: "\r", output: "\r"},
+		// the up arrow recalls the denied command from the history
+		{input: "\x1b[A\r", output: "\x1b[A\x03", denied: true},
+		// the tab completion
+		{input: "rm -rf /e\t\r", output: "rm -rf /e\t\x03", denied: true},
+		// the ctrl-c discards the incomplete line
+		{input: "\x1b[A\x03echo ok\r", output: "\x1b[A\x03echo ok\r"},
+	}
+	for _, tt := range tests {
+		output, reply := i.Intercept([]byte(tt.input))
+		assert.Equal(t, tt.output, string(output))
+		assert.Equal(t, tt.denied, len(reply) > 0, tt.input)
+	}
+
+	commands := make([]string, 0, len(events))
+	for _, e := range events {
+		assert.Equal(t, "alice", e.User)
+		assert.Equal(t, "demo", e.Pod)
+		commands = append(commands, e.Command)
+	}
+	assert.Equal(t, []string{"ls -l", "cat file", "rm -rf /", "shutdown ok", "", "rm -rf /e", "echo ok"}, commands)
+	assert.False(t, events[0].Denied)
+	assert.True(t, events[2].Denied)
+	assert.True(t, events[3].Denied)
+	assert.True(t, events[4].Incomplete)
+	assert.True(t, events[4].Denied)
+	assert.False(t, events[6].Incomplete)
+}
+
+func TestCommandInterceptorWithoutPolicy(t *testing.T) {
+	var events []AuditEvent
+	i := NewCommandAuditor("alice").WithHandler(func(e AuditEvent) {
+		events = append(events, e)
+	}).interceptorFor("default", "demo", "nginx")
+
+	output, reply := i.Intercept([]byte("ls\x1b[A\r"))
+	assert.Equal(t, "ls\x1b[A\r", string(output))
+	assert.Nil(t, reply)
+	assert.Equal(t, 1, len(events))
+	assert.True(t, events[0].Incomplete)
+	assert.False(t, events[0].Denied)
+
+	// the unknown control keys are sent to the container without the policy
+	output, reply = i.Intercept([]byte("ls\x0f"))
+	assert.Equal(t, "ls\x0f", string(output))
+	assert.Nil(t, reply)
+}
+
+func TestCommandInterceptorBypass(t *testing.T) {
+	policy, err := NewDenyPolicy(`^rm\s+-rf\s+/`)
+	assert.Nil(t, err)
+
+	var events []AuditEvent
+	i := NewCommandAuditor("alice").WithPolicy(policy).WithHandler(func(e AuditEvent) {
+		events = append(events, e)
+	}).interceptorFor("default", "demo", "nginx")
+
+	tests := []struct {
+		name   string
+		inputs []string
+		output string
+	}{
+		{
+			name:   "ctrl-o runs the line",
+			inputs: []string{"rm -rf /\x0f", "\r"},
+			output: "rm -rf /\x03",
+		},
+		{
+			name:   "ctrl-j is the enter key",
+			inputs: []string{"rm -rf /\n"},
+			output: "rm -rf /\x03",
+		},
+		{
+			name:   "ctrl-x ctrl-e runs the line in the editor",
+			inputs: []string{"rm -rf /\x18\x05", "\r"},
+			output: "rm -rf /\x05\x03",
+		},
+		{
+			name:   "alt-enter",
+			inputs: []string{"rm -rf /\x1b\r"},
+			output: "rm -rf /\x1b\x03",
+		},
+		{
+			name:   "continued by the backslash",
+			inputs: []string{"rm -rf \\\r", "/\r"},
+			output: "rm -rf \\\r/\x03",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events = nil
+			var output, reply []byte
+			for _, input := range tt.inputs {
+				o, r := i.Intercept([]byte(input))
+				output = append(output, o...)
+				reply = append(reply, r...)
+			}
+			assert.Equal(t, tt.output, string(output))
+			assert.NotEmpty(t, reply)
+			assert.Equal(t, 1, len(events))
+			assert.True(t, events[0].Denied)
+		})
+	}
+	assert.Equal(t, "rm -rf /", events[0].Command)
+
+	// the escaped backslash doesn't continue the line
+	events = nil
+	output, reply := i.Intercept([]byte("echo \\\\\r"))
+	assert.Equal(t, "echo \\\\\r", string(output))
+	assert.Nil(t, reply)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "echo \\\\", events[0].Command)
+	assert.False(t, events[0].Denied)
+}
@@ -0,0 +1,143 @@
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	"k8s.io/client-go/util/exec"
+	"k8s.io/klog/v2"
+)
+
+// ExecResult is the output and the exit code of the command.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// ExecCapture runs the command in the container without TTY, and returns the captured stdout, stderr and
+// the exit code parsed from the status channel. The command exited with non-zero code isn't an error.
+// The stdin is optional, the nil stdin means the command has no input.
+//
+// If the ctx is done before the command exits, the stream is closed and ExecCapture returns the ctx error.
+func ExecCapture(ctx context.Context, config *rest.Config, namespace, podName, containerName string, cmd []string, stdin io.Reader) (*ExecResult, error) {
+	var stdout, stderr bytes.Buffer
+	err := streamExec(ctx, config, namespace, podName, containerName, cmd, stdin, &stdout, &stderr)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	code, err := exitCode(err)
+	if err != nil {
+		return nil, err
+	}
+	return &ExecResult{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: code,
+	}, nil
+}
+
+// streamExec runs the command in the container without TTY with the SPDY executor. If the ctx is done
+// before the command exits, the connection is closed and the ctx error is returned.
+func streamExec(ctx context.Context, config *rest.Config, namespace, podName, containerName string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("exec")
+
+	req.VersionedParams(&corev1.PodExecOptions{
+		Container: containerName,
+		Command:   cmd,
+		Stdin:     stdin != nil,
+		Stdout:    stdout != nil,
+		Stderr:    stderr != nil,
+	}, scheme.ParameterCodec)
+
+	executor, err := newSPDYExecutorWithContext(ctx, config, req.URL())
+	if err != nil {
+		return err
+	}
+
+	err = executor.Stream(remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// newSPDYExecutorWithContext returns the SPDY executor bound to the ctx, the request is sent with the ctx,
+// and the connection is closed when the ctx is done, so the Stream returns without waiting the command exits.
+func newSPDYExecutorWithContext(ctx context.Context, config *rest.Config, url *url.URL) (remotecommand.Executor, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return nil, err
+	}
+	return remotecommand.NewSPDYExecutorForTransports(
+		&contextRoundTripper{ctx: ctx, rt: transport},
+		&contextUpgrader{ctx: ctx, upgrader: upgrader},
+		"POST", url)
+}
+
+// contextRoundTripper sends the requests with the ctx.
+type contextRoundTripper struct {
+	ctx context.Context
+	rt  http.RoundTripper
+}
+
+func (r *contextRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r.rt.RoundTrip(req.WithContext(r.ctx))
+}
+
+// contextUpgrader closes the upgraded connection when the ctx is done.
+type contextUpgrader struct {
+	ctx      context.Context
+	upgrader spdy.Upgrader
+}
+
+func (u *contextUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.upgrader.NewConnection(resp)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-u.ctx.Done():
+			klog.V(5).Infof("close the exec connection, %v", u.ctx.Err())
+			conn.Close()
+		case <-conn.CloseChan():
+		}
+	}()
+	return conn, nil
+}
+
+// exitCode returns the exit code of the command from the stream error, the error which isn't
+// the exit error is returned as is.
+func exitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	if exitErr, ok := err.(exec.ExitError); ok && exitErr.Exited() {
+		return exitErr.ExitStatus(), nil
+	}
+	return 0, err
+}
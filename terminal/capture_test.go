@@ -0,0 +1,172 @@
+package terminal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	remotecommandconsts "k8s.io/apimachinery/pkg/util/remotecommand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/exec"
+)
+
+// execRequest is the exec or attach request received by the fake exec server, the streams are nil
+// if they are not requested. The Done is closed when the client closes the connection.
+type execRequest struct {
+	Command []string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+	Done    <-chan bool
+}
+
+// newExecServer returns the server which serves the exec and attach requests with the SPDY v4 protocol.
+// The exec.CodeExitError returned by the handler is reported as the exit code of the command.
+// The request without any stream is rejected like the kubelet.
+func newExecServer(t *testing.T, handler func(req *execRequest) error) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("stdin") != "true" && query.Get("stdout") != "true" && query.Get("stderr") != "true" {
+			http.Error(w, "you must specify at least 1 of stdin, stdout, stderr", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := httpstream.Handshake(r, w, []string{remotecommandconsts.StreamProtocolV4Name}); err != nil {
+			t.Errorf("exec handshake error, %v", err)
+			return
+		}
+
+		streamCh := make(chan httpstream.Stream, 5)
+		conn := spdy.NewResponseUpgrader().UpgradeResponse(w, r, func(s httpstream.Stream, _ <-chan struct{}) error {
+			streamCh <- s
+			return nil
+		})
+		if conn == nil {
+			return
+		}
+		defer conn.Close()
+
+		tty := query.Get("tty") == "true"
+		expected := 1
+		for _, name := range []string{"stdin", "stdout"} {
+			if query.Get(name) == "true" {
+				expected++
+			}
+		}
+		if query.Get("stderr") == "true" && !tty {
+			expected++
+		}
+		if tty {
+			expected++
+		}
+
+		streams := make(map[string]httpstream.Stream)
+		for len(streams) < expected {
+			select {
+			case s := <-streamCh:
+				streams[s.Headers().Get(corev1.StreamType)] = s
+			case <-time.After(wait.ForeverTestTimeout):
+				t.Errorf("timed out waiting for the exec streams")
+				return
+			}
+		}
+
+		req := &execRequest{Command: query["command"], Done: conn.CloseChan()}
+		if s, ok := streams[corev1.StreamTypeStdin]; ok {
+			req.Stdin = s
+		}
+		if s, ok := streams[corev1.StreamTypeStdout]; ok {
+			req.Stdout = s
+		}
+		if s, ok := streams[corev1.StreamTypeStderr]; ok {
+			req.Stderr = s
+		}
+		err := handler(req)
+		for _, name := range []string{corev1.StreamTypeStdout, corev1.StreamTypeStderr} {
+			if s, ok := streams[name]; ok {
+				s.Close()
+			}
+		}
+
+		status := metav1.Status{Status: metav1.StatusSuccess}
+		if exitErr, ok := err.(exec.CodeExitError); ok {
+			status = metav1.Status{
+				Status:  metav1.StatusFailure,
+				Reason:  remotecommandconsts.NonZeroExitCodeReason,
+				Message: exitErr.Error(),
+				Details: &metav1.StatusDetails{Causes: []metav1.StatusCause{
+					{Type: remotecommandconsts.ExitCodeCauseType, Message: strconv.Itoa(exitErr.Code)},
+				}},
+			}
+		} else if err != nil {
+			status = metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+		}
+		errorStream := streams[corev1.StreamTypeError]
+		if err := json.NewEncoder(errorStream).Encode(status); err != nil {
+			return
+		}
+		errorStream.Close()
+	}))
+}
+
+func TestExecCapture(t *testing.T) {
+	server := newExecServer(t, func(req *execRequest) error {
+		input, _ := io.ReadAll(req.Stdin)
+		fmt.Fprintf(req.Stdout, "%s %s", strings.Join(req.Command, " "), input)
+		fmt.Fprint(req.Stderr, "warning")
+		return exec.CodeExitError{Err: fmt.Errorf("command terminated with non-zero exit code"), Code: 3}
+	})
+	defer server.Close()
+
+	result, err := ExecCapture(context.TODO(), &rest.Config{Host: server.URL}, "default", "demo", "app", []string{"cat", "-"}, strings.NewReader("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, &ExecResult{Stdout: "cat - hello", Stderr: "warning", ExitCode: 3}, result)
+}
+
+func TestExecCaptureCancel(t *testing.T) {
+	closed := make(chan struct{})
+	server := newExecServer(t, func(req *execRequest) error {
+		// the command never exits until the client closes the connection
+		<-req.Done
+		close(closed)
+		return nil
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+	_, err := ExecCapture(ctx, &rest.Config{Host: server.URL}, "default", "demo", "app", []string{"sleep", "infinity"}, nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	select {
+	case <-closed:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Errorf("the exec stream is not closed after the ctx is done")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	code, err := exitCode(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, code)
+
+	code, err = exitCode(exec.CodeExitError{Err: fmt.Errorf("command terminated with non-zero exit code"), Code: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, code)
+
+	_, err = exitCode(fmt.Errorf("connection refused"))
+	assert.EqualError(t, err, "connection refused")
+}
@@ -0,0 +1,422 @@
+package terminal
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+// ArchiveFormat is the archive format of the downloaded files.
+type ArchiveFormat string
+
+const (
+	TarArchive ArchiveFormat = "tar"
+	ZipArchive ArchiveFormat = "zip"
+)
+
+// CopyOptions is the options of copying files to and from the container.
+type CopyOptions struct {
+	// Progress is called with the total transferred bytes of the archive.
+	Progress func(transferred int64)
+}
+
+// CopyFileToContainer uploads the file to the destPath in the container, the size is the file size.
+// It's like `kubectl cp file pod:destPath`, the container needs the tar binary.
+func CopyFileToContainer(ctx context.Context, config *rest.Config, namespace, podName, containerName, destPath string, src io.Reader, size int64, opts *CopyOptions) error {
+	if err := validateContainerPath(destPath); err != nil {
+		return err
+	}
+
+	destPath = path.Clean(destPath)
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Base(destPath),
+			Size:     size,
+			Mode:     0644,
+			ModTime:  time.Now(),
+		})
+		if err == nil {
+			_, err = io.Copy(tw, src)
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	err := extractInContainer(ctx, config, namespace, podName, containerName, path.Dir(destPath), pr, opts)
+	// unblock the archiving if the extracting failed
+	pr.Close()
+	return err
+}
+
+// CopyTarToContainer extracts the tar archive to the destDir in the container. The archive entries
+// which escape the destDir are rejected, and the links point outside of the destDir are skipped.
+func CopyTarToContainer(ctx context.Context, config *rest.Config, namespace, podName, containerName, destDir string, archive io.Reader, opts *CopyOptions) error {
+	if err := validateContainerPath(destDir); err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	sanitizeErr := make(chan error, 1)
+	go func() {
+		err := sanitizeTar(archive, pw)
+		sanitizeErr <- err
+		pw.CloseWithError(err)
+	}()
+
+	err := extractInContainer(ctx, config, namespace, podName, containerName, path.Clean(destDir), pr, opts)
+	// unblock the sanitizing if the extracting failed
+	pr.Close()
+	// the invalid archive error is more helpful than the broken stream error
+	select {
+	case e := <-sanitizeErr:
+		if e != nil && e != io.ErrClosedPipe {
+			return e
+		}
+	default:
+	}
+	return err
+}
+
+// extractInContainer extracts the tar stream to the destDir in the container.
+func extractInContainer(ctx context.Context, config *rest.Config, namespace, podName, containerName, destDir string, archive io.Reader, opts *CopyOptions) error {
+	stdin := &copyReader{ctx: ctx, r: archive, progress: progressFunc(opts)}
+	cmd := []string{"tar", "-xmf", "-", "-C", destDir}
+
+	var stderr bytes.Buffer
+	err := streamExec(ctx, config, namespace, podName, containerName, cmd, stdin, nil, &stderr)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("extract archive to %s in container %s error, %v: %s", destDir, containerName, err, stderr.String())
+	}
+	return nil
+}
+
+// CopyFromContainer downloads the srcPath in the container as the tar or zip archive to w.
+// It's like `kubectl cp pod:srcPath dest`, the container needs the tar binary.
+// The archive entries which escape the srcPath are rejected, and the links point outside of the srcPath are skipped.
+func CopyFromContainer(ctx context.Context, config *rest.Config, namespace, podName, containerName, srcPath string, w io.Writer, format ArchiveFormat, opts *CopyOptions) error {
+	if err := validateContainerPath(srcPath); err != nil {
+		return err
+	}
+	if format != TarArchive && format != ZipArchive {
+		return fmt.Errorf("unsupported archive format %s", format)
+	}
+
+	srcPath = path.Clean(srcPath)
+	dir, base := path.Dir(srcPath), path.Base(srcPath)
+	if base == "/" {
+		base = "."
+	}
+	// the file name begins with "-" would be parsed as the tar flag
+	if strings.HasPrefix(base, "-") {
+		base = "./" + base
+	}
+	cmd := []string{"tar", "-cf", "-", "-C", dir, base}
+
+	pr, pw := io.Pipe()
+	var stderr bytes.Buffer
+	execErr := make(chan error, 1)
+	go func() {
+		err := streamExec(ctx, config, namespace, podName, containerName, cmd, nil, pw, &stderr)
+		execErr <- err
+		pw.CloseWithError(err)
+	}()
+
+	out := &copyWriter{ctx: ctx, w: w, progress: progressFunc(opts)}
+	var err error
+	if format == ZipArchive {
+		err = tarToZip(pr, out)
+	} else {
+		err = sanitizeTar(pr, out)
+	}
+	if err == nil {
+		// discard the padding after the end of the archive
+		_, err = io.Copy(io.Discard, pr)
+	}
+	// unblock the stream if the archive conversion failed
+	pr.CloseWithError(err)
+
+	if e := <-execErr; e != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("archive %s in container %s error, %v: %s", srcPath, containerName, e, stderr.String())
+	}
+	return err
+}
+
+// validateContainerPath rejects the empty path and the path contains "..".
+func validateContainerPath(p string) error {
+	if p == "" {
+		return fmt.Errorf("the container path is required")
+	}
+	for _, elem := range strings.Split(p, "/") {
+		if elem == ".." {
+			return fmt.Errorf("the container path %s must not contain \"..\"", p)
+		}
+	}
+	return nil
+}
+
+// validateArchivePath rejects the archive entry which is absolute or escapes the archive root.
+func validateArchivePath(name string) error {
+	clean := path.Clean(name)
+	if path.IsAbs(name) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("archive entry %s is outside of the destination", name)
+	}
+	return nil
+}
+
+// archiveFilter checks the archive entries in order, it fails at the entry outside of the archive root,
+// and skips the links which may point outside of the archive root like `kubectl cp`.
+//
+// Every link is checked lexically, but a chain of the links escapes the root although each of them
+// points inside, such as "a -> ." and then "a/b -> ..". So the emitted symlinks are tracked, the entry
+// under an emitted symlink is rejected, the link which goes through an emitted symlink is skipped, and
+// the symlink whose name is a directory used by the emitted entries is skipped.
+type archiveFilter struct {
+	// symlinks is the names of the emitted symlinks
+	symlinks map[string]bool
+	// traversed is the directories which the emitted entries are under or the emitted links go through
+	traversed map[string]bool
+}
+
+func newArchiveFilter() *archiveFilter {
+	return &archiveFilter{
+		symlinks:  make(map[string]bool),
+		traversed: make(map[string]bool),
+	}
+}
+
+// next returns the next valid entry of the archive.
+func (f *archiveFilter) next(tr *tar.Reader) (*tar.Header, error) {
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if err := validateArchivePath(hdr.Name); err != nil {
+			return nil, err
+		}
+
+		name := path.Clean(hdr.Name)
+		parents := parentDirs(name)
+		for _, dir := range parents {
+			if f.symlinks[dir] {
+				return nil, fmt.Errorf("archive entry %s is under the symlink %s", hdr.Name, dir)
+			}
+		}
+
+		var through []string
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			if name == "." || f.traversed[name] {
+				klog.Warningf("skipping the symlink %s -> %s, it replaces a directory of the destination", hdr.Name, hdr.Linkname)
+				continue
+			}
+			if path.IsAbs(hdr.Linkname) {
+				klog.Warningf("skipping the symlink %s -> %s, it points outside of the destination", hdr.Name, hdr.Linkname)
+				continue
+			}
+			through, err = f.resolveLink(path.Dir(name), hdr.Linkname)
+		case tar.TypeLink:
+			through, err = f.resolveLink(".", hdr.Linkname)
+		}
+		if err != nil {
+			klog.Warningf("skipping the link %s -> %s, %v", hdr.Name, hdr.Linkname, err)
+			continue
+		}
+
+		for _, dir := range append(parents, through...) {
+			f.traversed[dir] = true
+		}
+		if hdr.Typeflag == tar.TypeSymlink {
+			f.symlinks[name] = true
+		}
+		return hdr, nil
+	}
+}
+
+// resolveLink resolves the link target from the dir lexically, and returns the directories it goes through.
+// It fails if the target is outside of the archive root or goes through an emitted symlink.
+func (f *archiveFilter) resolveLink(dir, target string) ([]string, error) {
+	var stack, through []string
+	if dir != "." {
+		stack = strings.Split(dir, "/")
+	}
+
+	elems := strings.Split(target, "/")
+	for i, elem := range elems {
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("it points outside of the destination")
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			stack = append(stack, elem)
+		}
+
+		if i == len(elems)-1 || len(stack) == 0 {
+			continue
+		}
+		current := strings.Join(stack, "/")
+		if f.symlinks[current] {
+			return nil, fmt.Errorf("it goes through the symlink %s", current)
+		}
+		through = append(through, current)
+	}
+	return through, nil
+}
+
+// parentDirs returns the parent directories of the cleaned archive path, such as [a a/b] of a/b/c.
+func parentDirs(name string) []string {
+	var dirs []string
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' {
+			dirs = append(dirs, name[:i])
+		}
+	}
+	return dirs
+}
+
+// sanitizeTar copies the tar archive from src to dst, it fails at the entry outside of the archive root,
+// and skips the unsafe links, see archiveFilter.
+func sanitizeTar(src io.Reader, dst io.Writer) error {
+	tr := tar.NewReader(src)
+	tw := tar.NewWriter(dst)
+	filter := newArchiveFilter()
+	for {
+		hdr, err := filter.next(tr)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// tarToZip converts the tar archive to the zip archive, the entries except the directories,
+// regular files and symlinks are skipped.
+func tarToZip(src io.Reader, dst io.Writer) error {
+	tr := tar.NewReader(src)
+	zw := zip.NewWriter(dst)
+	filter := newArchiveFilter()
+	for {
+		hdr, err := filter.next(tr)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeReg, tar.TypeSymlink:
+		default:
+			continue
+		}
+
+		zh, err := zip.FileInfoHeader(hdr.FileInfo())
+		if err != nil {
+			return err
+		}
+		zh.Name = strings.TrimPrefix(path.Clean(hdr.Name), "./")
+		zh.Method = zip.Deflate
+		if hdr.Typeflag == tar.TypeDir {
+			zh.Name += "/"
+			zh.Method = zip.Store
+		}
+
+		fw, err := zw.CreateHeader(zh)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			_, err = io.Copy(fw, tr)
+		case tar.TypeSymlink:
+			// the zip saves the symlink target as the content
+			_, err = fw.Write([]byte(hdr.Linkname))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func progressFunc(opts *CopyOptions) func(int64) {
+	if opts == nil {
+		return nil
+	}
+	return opts.Progress
+}
+
+// copyReader reports the progress of reading, and stops reading when the ctx is done.
+type copyReader struct {
+	ctx         context.Context
+	r           io.Reader
+	transferred int64
+	progress    func(int64)
+}
+
+func (r *copyReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.transferred += int64(n)
+		if r.progress != nil {
+			r.progress(r.transferred)
+		}
+	}
+	return n, err
+}
+
+// copyWriter reports the progress of writing, and stops writing when the ctx is done.
+type copyWriter struct {
+	ctx         context.Context
+	w           io.Writer
+	transferred int64
+	progress    func(int64)
+}
+
+func (w *copyWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := w.w.Write(p)
+	w.transferred += int64(n)
+	if n > 0 && w.progress != nil {
+		w.progress(w.transferred)
+	}
+	return n, err
+}
@@ -0,0 +1,309 @@
+package terminal
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/exec"
+)
+
+type testEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	content  string
+}
+
+func testTar(t *testing.T, entries ...testEntry) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		assert.Nil(t, tw.WriteHeader(&tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Size:     int64(len(e.content)),
+			Mode:     0644,
+		}))
+		_, err := tw.Write([]byte(e.content))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tw.Close())
+	return buf
+}
+
+func tarNames(t *testing.T, r io.Reader) []string {
+	var names []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		assert.Nil(t, err)
+		names = append(names, hdr.Name)
+	}
+}
+
+func TestValidateContainerPath(t *testing.T) {
+	assert.Nil(t, validateContainerPath("/tmp/app.log"))
+	assert.Nil(t, validateContainerPath("data/..config"))
+	assert.Error(t, validateContainerPath(""))
+	assert.Error(t, validateContainerPath("/tmp/../etc/passwd"))
+}
+
+func TestSanitizeTar(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := sanitizeTar(testTar(t,
+		testEntry{name: "app/", typeflag: tar.TypeDir},
+		testEntry{name: "app/config.yaml", typeflag: tar.TypeReg, content: "a: b"},
+		testEntry{name: "app/current", typeflag: tar.TypeSymlink, linkname: "config.yaml"},
+		testEntry{name: "app/passwd", typeflag: tar.TypeSymlink, linkname: "../../etc/passwd"},
+		testEntry{name: "app/localtime", typeflag: tar.TypeSymlink, linkname: "/etc/localtime"},
+	), out)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app/", "app/config.yaml", "app/current"}, tarNames(t, out))
+
+	for _, name := range []string{"../evil", "/etc/cron.d/evil", "app/../../evil"} {
+		err = sanitizeTar(testTar(t, testEntry{name: name, typeflag: tar.TypeReg, content: "evil"}), io.Discard)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestSanitizeTarSymlinkChain(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "entry under symlink",
+			entries: []testEntry{
+				{name: "a", typeflag: tar.TypeSymlink, linkname: "."},
+				{name: "a/b", typeflag: tar.TypeSymlink, linkname: ".."},
+			},
+			wantErr: true,
+		},
+		{
+			name: "link through symlink",
+			entries: []testEntry{
+				{name: "a", typeflag: tar.TypeSymlink, linkname: "."},
+				{name: "b", typeflag: tar.TypeSymlink, linkname: "a/.."},
+				{name: "c", typeflag: tar.TypeLink, linkname: "a/../etc/passwd"},
+				{name: "d", typeflag: tar.TypeSymlink, linkname: "a"},
+			},
+			want: []string{"a", "d"},
+		},
+		{
+			name: "symlink replaces directory",
+			entries: []testEntry{
+				{name: "app/", typeflag: tar.TypeDir},
+				{name: "app/config.yaml", typeflag: tar.TypeReg, content: "a: b"},
+				{name: "app", typeflag: tar.TypeSymlink, linkname: "."},
+				{name: "./app/current", typeflag: tar.TypeSymlink, linkname: "config.yaml"},
+			},
+			want: []string{"app/", "app/config.yaml", "./app/current"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := sanitizeTar(testTar(t, tt.entries...), out)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, tarNames(t, out))
+		})
+	}
+}
+
+func TestTarToZip(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := tarToZip(testTar(t,
+		testEntry{name: "./app", typeflag: tar.TypeDir},
+		testEntry{name: "./app/config.yaml", typeflag: tar.TypeReg, content: "a: b"},
+		testEntry{name: "./app/fifo", typeflag: tar.TypeFifo},
+	), out)
+	assert.Nil(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(zr.File))
+	assert.Equal(t, "app/", zr.File[0].Name)
+	assert.Equal(t, "app/config.yaml", zr.File[1].Name)
+
+	rc, err := zr.File[1].Open()
+	assert.Nil(t, err)
+	content, err := io.ReadAll(rc)
+	assert.Nil(t, err)
+	assert.Equal(t, "a: b", string(content))
+}
+
+func TestCopyReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	var transferred []int64
+	r := &copyReader{ctx: ctx, r: bytes.NewReader([]byte("hello world")), progress: func(n int64) {
+		transferred = append(transferred, n)
+	}}
+
+	p := make([]byte, 5)
+	_, err := r.Read(p)
+	assert.Nil(t, err)
+	_, err = r.Read(p)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{5, 10}, transferred)
+
+	cancel()
+	_, err = r.Read(p)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestCopyFileToContainer(t *testing.T) {
+	var command []string
+	var received map[string]string
+	server := newExecServer(t, func(req *execRequest) error {
+		command = req.Command
+		received = tarContents(t, req.Stdin)
+		return nil
+	})
+	defer server.Close()
+
+	var transferred int64
+	err := CopyFileToContainer(context.TODO(), &rest.Config{Host: server.URL}, "default", "demo", "app", "/tmp/app.log",
+		strings.NewReader("hello"), 5, &CopyOptions{Progress: func(n int64) { transferred = n }})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tar", "-xmf", "-", "-C", "/tmp"}, command)
+	assert.Equal(t, map[string]string{"app.log": "hello"}, received)
+	assert.True(t, transferred > 5)
+
+	assert.Error(t, CopyFileToContainer(context.TODO(), &rest.Config{Host: server.URL}, "default", "demo", "app", "/tmp/../etc/passwd",
+		strings.NewReader("hello"), 5, nil))
+}
+
+func TestCopyFileToContainerCancel(t *testing.T) {
+	server := newExecServer(t, func(req *execRequest) error {
+		io.Copy(io.Discard, req.Stdin)
+		return nil
+	})
+	defer server.Close()
+
+	// the source never ends
+	src, w := io.Pipe()
+	defer w.Close()
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+	err := CopyFileToContainer(ctx, &rest.Config{Host: server.URL}, "default", "demo", "app", "/tmp/app.log", src, 5, nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestCopyTarToContainer(t *testing.T) {
+	var received map[string]string
+	server := newExecServer(t, func(req *execRequest) error {
+		received = tarContents(t, req.Stdin)
+		if received == nil {
+			fmt.Fprint(req.Stderr, "tar: Unexpected EOF in archive")
+			return exec.CodeExitError{Err: fmt.Errorf("command terminated with non-zero exit code"), Code: 2}
+		}
+		return nil
+	})
+	defer server.Close()
+	config := &rest.Config{Host: server.URL}
+
+	err := CopyTarToContainer(context.TODO(), config, "default", "demo", "app", "/data", testTar(t,
+		testEntry{name: "app/config.yaml", typeflag: tar.TypeReg, content: "a: b"},
+		testEntry{name: "app/passwd", typeflag: tar.TypeSymlink, linkname: "../../etc/passwd"},
+	), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"app/config.yaml": "a: b"}, received)
+
+	// the invalid archive error is returned instead of the broken stream error
+	err = CopyTarToContainer(context.TODO(), config, "default", "demo", "app", "/data", testTar(t,
+		testEntry{name: "app/config.yaml", typeflag: tar.TypeReg, content: "a: b"},
+		testEntry{name: "../evil", typeflag: tar.TypeReg, content: "evil"},
+	), nil)
+	assert.EqualError(t, err, "archive entry ../evil is outside of the destination")
+}
+
+func TestCopyFromContainer(t *testing.T) {
+	var command []string
+	server := newExecServer(t, func(req *execRequest) error {
+		command = req.Command
+		_, err := io.Copy(req.Stdout, testTar(t,
+			testEntry{name: "logs/", typeflag: tar.TypeDir},
+			testEntry{name: "logs/app.log", typeflag: tar.TypeReg, content: "hello"},
+			testEntry{name: "logs/passwd", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"},
+		))
+		return err
+	})
+	defer server.Close()
+	config := &rest.Config{Host: server.URL}
+
+	out := &bytes.Buffer{}
+	err := CopyFromContainer(context.TODO(), config, "default", "demo", "app", "/data/logs", out, TarArchive, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tar", "-cf", "-", "-C", "/data", "logs"}, command)
+	assert.Equal(t, []string{"logs/", "logs/app.log"}, tarNames(t, out))
+
+	out.Reset()
+	err = CopyFromContainer(context.TODO(), config, "default", "demo", "app", "/data/-logs", out, ZipArchive, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tar", "-cf", "-", "-C", "/data", "./-logs"}, command)
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(zr.File))
+
+	err = CopyFromContainer(context.TODO(), config, "default", "demo", "app", "/data/logs", out, "rar", nil)
+	assert.Error(t, err)
+}
+
+func TestCopyFromContainerCancel(t *testing.T) {
+	server := newExecServer(t, func(req *execRequest) error {
+		// the archive never ends until the client closes the connection
+		tw := tar.NewWriter(req.Stdout)
+		tw.WriteHeader(&tar.Header{Name: "big.log", Typeflag: tar.TypeReg, Size: 1 << 30, Mode: 0644})
+		tw.Write([]byte("hello"))
+		<-req.Done
+		return nil
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+	err := CopyFromContainer(ctx, &rest.Config{Host: server.URL}, "default", "demo", "app", "/data/big.log", io.Discard, TarArchive, nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+// tarContents returns the contents of the regular files in the tar archive, it returns nil if the archive is broken.
+func tarContents(t *testing.T, r io.Reader) map[string]string {
+	contents := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return contents
+		}
+		if err != nil {
+			return nil
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil
+		}
+		contents[hdr.Name] = string(data)
+	}
+}
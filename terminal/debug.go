@@ -0,0 +1,190 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+	"k8s.io/klog/v2"
+)
+
+// DefaultDebugTimeout is the default timeout of waiting for the debug container running.
+const DefaultDebugTimeout = 5 * time.Minute
+
+// DebugOptions is the options of the ephemeral debug container.
+type DebugOptions struct {
+	// Image is the image of the debug container, such as busybox.
+	Image string
+	// Name is the name of the debug container, it's generated with the "debugger-" prefix if empty.
+	Name string
+	// TargetContainer is the container whose process namespace is shared with the debug container.
+	TargetContainer string
+	// Command is the command of the debug container, the image entrypoint is used if empty.
+	Command    []string
+	PullPolicy corev1.PullPolicy
+	// Timeout is the timeout of waiting for the debug container running, DefaultDebugTimeout is used if it's 0.
+	Timeout time.Duration
+	// AttachOptions is the options of attaching the debug container, the stdin, stdout, stderr and TTY
+	// are attached if it's nil.
+	AttachOptions *ExecOptions
+}
+
+// Debug creates an ephemeral debug container in the pod, waits until it is running and attaches the session to it.
+// It's like `kubectl debug`, is useful for the distroless pods which have no shell.
+//
+// If the opts.AttachOptions.Impersonate is set, the debug container is created and watched as the user, after
+// checking the user is allowed to update the pods/ephemeralcontainers, and the attach is sent as the user too.
+func (t *TerminalSession) Debug(ctx context.Context, config *rest.Config, namespace, podName string, opts *DebugOptions) error {
+	if opts == nil {
+		return fmt.Errorf("the debug options are required")
+	}
+
+	attachOpts := opts.AttachOptions
+	if attachOpts == nil {
+		attachOpts = &ExecOptions{
+			Stdin:  true,
+			Stdout: true,
+			Stderr: true,
+			TTY:    true,
+		}
+	}
+
+	client := t.client
+	if attachOpts.Impersonate != nil {
+		c, err := kubernetes.NewForConfig(impersonatedConfig(config, *attachOpts.Impersonate))
+		if err != nil {
+			return err
+		}
+		if err := checkPodAccess(ctx, c, attachOpts.Impersonate.UserName, "update", namespace, podName, "ephemeralcontainers"); err != nil {
+			return err
+		}
+		client = c
+	}
+
+	name, err := createDebugContainer(ctx, client, namespace, podName, opts)
+	if err != nil {
+		return err
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultDebugTimeout
+	}
+	if err := waitForEphemeralContainerRunning(ctx, client, namespace, podName, name, timeout); err != nil {
+		return err
+	}
+
+	return t.Attach(ctx, config, namespace, podName, name, attachOpts)
+}
+
+// createDebugContainer adds the ephemeral container to the pod, and returns the container name.
+func createDebugContainer(ctx context.Context, c kubernetes.Interface, namespace, podName string, opts *DebugOptions) (string, error) {
+	if opts.Image == "" {
+		return "", fmt.Errorf("the image of the debug container is required")
+	}
+
+	pod, err := c.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = fmt.Sprintf("debugger-%s", utilrand.String(5))
+	}
+	for _, ec := range pod.Spec.EphemeralContainers {
+		if ec.Name == name {
+			return "", fmt.Errorf("ephemeral container %s already exists in pod %s/%s", name, namespace, podName)
+		}
+	}
+
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:                     name,
+			Image:                    opts.Image,
+			Command:                  opts.Command,
+			ImagePullPolicy:          opts.PullPolicy,
+			Stdin:                    true,
+			TTY:                      true,
+			TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+		},
+		TargetContainerName: opts.TargetContainer,
+	})
+
+	klog.V(5).Infof("create ephemeral container %s in pod %s/%s", name, namespace, podName)
+	if _, err := c.CoreV1().Pods(namespace).UpdateEphemeralContainers(ctx, podName, pod, metav1.UpdateOptions{}); err != nil {
+		return "", fmt.Errorf("create ephemeral container in pod %s/%s error, %v", namespace, podName, err)
+	}
+	return name, nil
+}
+
+// waitForEphemeralContainerRunning waits until the ephemeral container is running,
+// it fails fast if the container is terminated or can't pull the image.
+func waitForEphemeralContainerRunning(ctx context.Context, c kubernetes.Interface, namespace, podName, containerName string, timeout time.Duration) error {
+	watchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", podName).String()
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return c.CoreV1().Pods(namespace).List(watchCtx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return c.CoreV1().Pods(namespace).Watch(watchCtx, options)
+		},
+	}
+
+	_, err := watchtools.UntilWithSync(watchCtx, lw, &corev1.Pod{}, nil, func(e watch.Event) (bool, error) {
+		switch e.Type {
+		case watch.Deleted:
+			return false, fmt.Errorf("pod %s/%s has been deleted", namespace, podName)
+		case watch.Added, watch.Modified:
+			return ephemeralContainerRunning(e.Object.(*corev1.Pod), containerName)
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		// UntilWithSync returns ErrWaitTimeout when the ctx is cancelled too
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if watchCtx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out waiting for the ephemeral container %s running in pod %s/%s", containerName, namespace, podName)
+		}
+	}
+	return err
+}
+
+func ephemeralContainerRunning(pod *corev1.Pod, containerName string) (bool, error) {
+	for _, cs := range pod.Status.EphemeralContainerStatuses {
+		if cs.Name != containerName {
+			continue
+		}
+		switch {
+		case cs.State.Running != nil:
+			return true, nil
+		case cs.State.Terminated != nil:
+			return false, fmt.Errorf("ephemeral container %s terminated, reason %s", containerName, cs.State.Terminated.Reason)
+		case cs.State.Waiting != nil && isImagePullError(cs.State.Waiting.Reason):
+			return false, fmt.Errorf("ephemeral container %s can't pull the image, %s", containerName, cs.State.Waiting.Message)
+		}
+	}
+	return false, nil
+}
+
+func isImagePullError(reason string) bool {
+	return reason == "ErrImagePull" || reason == "ImagePullBackOff" || reason == "InvalidImageName"
+}
@@ -0,0 +1,71 @@
+package terminal
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateDebugContainer(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: metav1.NamespaceDefault},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "distroless"}}},
+	}
+	client := fake.NewSimpleClientset(pod)
+
+	_, err := createDebugContainer(context.TODO(), client, metav1.NamespaceDefault, "demo", &DebugOptions{})
+	assert.Error(t, err)
+
+	name, err := createDebugContainer(context.TODO(), client, metav1.NamespaceDefault, "demo", &DebugOptions{
+		Image:           "busybox",
+		TargetContainer: "app",
+	})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(name, "debugger-"))
+
+	updated, err := client.CoreV1().Pods(metav1.NamespaceDefault).Get(context.TODO(), "demo", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(updated.Spec.EphemeralContainers))
+	ec := updated.Spec.EphemeralContainers[0]
+	assert.Equal(t, name, ec.Name)
+	assert.Equal(t, "busybox", ec.Image)
+	assert.Equal(t, "app", ec.TargetContainerName)
+	assert.True(t, ec.Stdin && ec.TTY)
+
+	_, err = createDebugContainer(context.TODO(), client, metav1.NamespaceDefault, "demo", &DebugOptions{Image: "busybox", Name: name})
+	assert.Error(t, err)
+}
+
+func TestWaitForEphemeralContainerRunning(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: metav1.NamespaceDefault},
+		Status: corev1.PodStatus{
+			EphemeralContainerStatuses: []corev1.ContainerStatus{
+				{Name: "debugger-a", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				{Name: "debugger-b", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}},
+				{Name: "debugger-c", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+			},
+		},
+	}
+	client := fake.NewSimpleClientset(pod)
+
+	assert.Nil(t, waitForEphemeralContainerRunning(context.TODO(), client, metav1.NamespaceDefault, "demo", "debugger-a", time.Second))
+	assert.Error(t, waitForEphemeralContainerRunning(context.TODO(), client, metav1.NamespaceDefault, "demo", "debugger-b", time.Second))
+	assert.EqualError(t, waitForEphemeralContainerRunning(context.TODO(), client, metav1.NamespaceDefault, "demo", "debugger-c", 100*time.Millisecond),
+		"timed out waiting for the ephemeral container debugger-c running in pod default/demo")
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	assert.Equal(t, context.Canceled, waitForEphemeralContainerRunning(ctx, client, metav1.NamespaceDefault, "demo", "debugger-c", time.Minute))
+}
+
+func TestDebugWithoutOptions(t *testing.T) {
+	ts := &TerminalSession{client: fake.NewSimpleClientset()}
+	assert.EqualError(t, ts.Debug(context.TODO(), nil, metav1.NamespaceDefault, "demo", nil), "the debug options are required")
+}
@@ -43,7 +43,31 @@ func ValidatePod(ctx context.Context, client kubernetes.Interface, namespace, po
 	return fmt.Errorf("pod has no container %s", containerName)
 }
 
-func (t *TerminalSession) Exec(config *rest.Config, namespace, podName, containerName string, cmd []string, opts *ExecOptions) error {
+// Exec runs the command in the container and streams it with the session. The ctx is used by the access check
+// and the shell detection, and closes the SPDY stream when it's done.
+func (t *TerminalSession) Exec(ctx context.Context, config *rest.Config, namespace, podName, containerName string, cmd []string, opts *ExecOptions) error {
+	config, err := impersonate(ctx, config, namespace, podName, "exec", opts)
+	if err != nil {
+		return err
+	}
+
+	if len(cmd) == 0 && len(opts.Shells) > 0 {
+		shell, err := detectShell(ctx, config, namespace, podName, containerName, opts.Shells)
+		if err != nil {
+			return err
+		}
+		if opts.ShellChosen != nil {
+			opts.ShellChosen(shell)
+		}
+		// the websocket executor streams the raw channel frames, the shell message would corrupt it
+		if !opts.websocketExecutor() {
+			if err := t.writeJSON(TerminalMessage{Op: "shell", Data: shell}); err != nil {
+				return err
+			}
+		}
+		cmd = []string{shell}
+	}
+
 	req := t.client.CoreV1().RESTClient().Post().
 		Resource("pods").
 		Name(podName).
@@ -59,26 +83,110 @@ func (t *TerminalSession) Exec(config *rest.Config, namespace, podName, containe
 		TTY:       opts.TTY,
 	}, scheme.ParameterCodec)
 
-	if opts.TTY && (opts.Executor == WebsocketExecutorType || opts.Executor == "") {
+	return t.stream(ctx, config, req, namespace, podName, containerName, opts)
+}
+
+// Attach attaches to the main process of the running container or ephemeral container, the container should be started
+// with the stdin and tty if the opts.Stdin and opts.TTY are true. It's like `kubectl attach`.
+func (t *TerminalSession) Attach(ctx context.Context, config *rest.Config, namespace, podName, containerName string, opts *ExecOptions) error {
+	// check the access of the user before reading the pod with the client
+	config, err := impersonate(ctx, config, namespace, podName, "attach", opts)
+	if err != nil {
+		return err
+	}
+	pod, err := t.client.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if err := validateAttachContainer(pod, containerName, opts); err != nil {
+		return err
+	}
+
+	req := t.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("attach")
+
+	req.VersionedParams(&corev1.PodAttachOptions{
+		Container: containerName,
+		Stdin:     opts.Stdin,
+		Stdout:    opts.Stdout,
+		Stderr:    opts.Stderr,
+		TTY:       opts.TTY,
+	}, scheme.ParameterCodec)
+
+	return t.stream(ctx, config, req, namespace, podName, containerName, opts)
+}
+
+// validateAttachContainer checks the container is running and allocated the stdin and tty which the opts requires.
+func validateAttachContainer(pod *corev1.Pod, containerName string, opts *ExecOptions) error {
+	if pod.Status.Phase != corev1.PodRunning {
+		return fmt.Errorf("cannot attach a container in a not running pod, current phase %s", pod.Status.Phase)
+	}
+
+	for _, c := range pod.Spec.Containers {
+		if c.Name == containerName {
+			return validateAttachStreams(containerName, c.Stdin, c.TTY, opts)
+		}
+	}
+	for _, ec := range pod.Spec.EphemeralContainers {
+		if ec.Name == containerName {
+			return validateAttachStreams(containerName, ec.Stdin, ec.TTY, opts)
+		}
+	}
+	return fmt.Errorf("pod has no container %s", containerName)
+}
+
+func validateAttachStreams(containerName string, stdin, tty bool, opts *ExecOptions) error {
+	if opts.Stdin && !stdin {
+		return fmt.Errorf("container %s is not started with stdin", containerName)
+	}
+	if opts.TTY && !tty {
+		return fmt.Errorf("container %s is not started with tty", containerName)
+	}
+	return nil
+}
+
+// stream streams the exec or attach request with the websocket or SPDY executor, the SPDY stream is closed when the ctx is done.
+func (t *TerminalSession) stream(ctx context.Context, config *rest.Config, req *rest.Request, namespace, podName, containerName string, opts *ExecOptions) error {
+	var interceptor wsremotecommand.StdinInterceptor
+	if t.auditor != nil {
+		// the denied reason is replied as the stdout, see commandInterceptor.Intercept
+		t.interceptor = t.auditor.interceptorFor(namespace, podName, containerName)
+		interceptor = t.interceptor
+	}
+
+	if opts.websocketExecutor() {
 		executor, err := wsremotecommand.NewWebSocketExecutor(config, req.URL(), []string{t.wsConn.Subprotocol()})
 		if err != nil {
 			return err
 		}
 		return executor.Stream(wsremotecommand.StreamOptions{
-			Stdin: t.wsConn,
+			Stdin:            t.wsConn,
+			Recorder:         t.recorder,
+			StdinInterceptor: interceptor,
 		})
 	}
 
-	executor, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	executor, err := newSPDYExecutorWithContext(ctx, config, req.URL())
 	if err != nil {
 		return err
 	}
 
-	return executor.Stream(remotecommand.StreamOptions{
-		Stdin:             t,
-		Stdout:            t,
-		Stderr:            t,
-		Tty:               true,
-		TerminalSizeQueue: t,
-	})
+	// the streams must be consistent with the exec options
+	streamOptions := remotecommand.StreamOptions{Tty: opts.TTY}
+	if opts.Stdin {
+		streamOptions.Stdin = t
+	}
+	if opts.Stdout {
+		streamOptions.Stdout = t
+	}
+	if opts.Stderr {
+		streamOptions.Stderr = t
+	}
+	if opts.TTY {
+		streamOptions.TerminalSizeQueue = t
+	}
+	return executor.Stream(streamOptions)
 }
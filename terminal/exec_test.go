@@ -0,0 +1,206 @@
+package terminal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// newSessionServer returns the websocket server which runs the fn with the terminal session,
+// the session client sends the requests to the config host. The error of the fn is sent to errCh.
+func newSessionServer(t *testing.T, config *rest.Config, fn func(ts *TerminalSession) error) (*httptest.Server, <-chan error) {
+	client, err := kubernetes.NewForConfig(config)
+	assert.Nil(t, err)
+
+	errCh := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts, err := NewTerminalSession(client, w, r, nil)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer ts.Close()
+		errCh <- fn(ts)
+	}))
+	return server, errCh
+}
+
+// readStdout reads the stdout messages of the session until the connection is closed.
+func readStdout(t *testing.T, conn *websocket.Conn) string {
+	var out strings.Builder
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return out.String()
+		}
+		var msg TerminalMessage
+		assert.Nil(t, json.Unmarshal(data, &msg))
+		assert.Equal(t, "stdout", msg.Op)
+		out.WriteString(msg.Data)
+	}
+}
+
+func TestExecWithoutTTY(t *testing.T) {
+	const lines = 100
+	execServer := newExecServer(t, func(req *execRequest) error {
+		// the stdout and stderr are copied to the session concurrently
+		var wg sync.WaitGroup
+		for _, w := range []io.Writer{req.Stdout, req.Stderr} {
+			wg.Add(1)
+			go func(w io.Writer) {
+				defer wg.Done()
+				for i := 0; i < lines; i++ {
+					fmt.Fprintln(w, "x")
+				}
+			}(w)
+		}
+		wg.Wait()
+		return nil
+	})
+	defer execServer.Close()
+
+	config := &rest.Config{Host: execServer.URL}
+	server, errCh := newSessionServer(t, config, func(ts *TerminalSession) error {
+		return ts.Exec(context.TODO(), config, "default", "demo", "app", []string{"seq"}, &ExecOptions{
+			Stdout:   true,
+			Stderr:   true,
+			Executor: SPDYExecutorType,
+		})
+	})
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	out := readStdout(t, conn)
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, strings.Repeat("x\n", 2*lines), out)
+}
+
+func TestValidateAttachContainer(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "shell", Stdin: true, TTY: true},
+				{Name: "server"},
+			},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	opts := &ExecOptions{Stdin: true, Stdout: true, TTY: true}
+
+	assert.Nil(t, validateAttachContainer(pod, "shell", opts))
+	assert.EqualError(t, validateAttachContainer(pod, "server", opts), "container server is not started with stdin")
+	assert.Nil(t, validateAttachContainer(pod, "server", &ExecOptions{Stdout: true}))
+	assert.EqualError(t, validateAttachContainer(pod, "sidecar", opts), "pod has no container sidecar")
+
+	pod.Status.Phase = corev1.PodPending
+	assert.Error(t, validateAttachContainer(pod, "shell", opts))
+}
+
+func TestExecDetectShell(t *testing.T) {
+	var commands [][]string
+	execServer := newExecServer(t, func(req *execRequest) error {
+		commands = append(commands, req.Command)
+		if req.Command[0] != "sh" {
+			return fmt.Errorf(`exec: "%s": executable file not found in $PATH`, req.Command[0])
+		}
+		if req.Stdout != nil {
+			fmt.Fprint(req.Stdout, "$ ")
+		}
+		return nil
+	})
+	defer execServer.Close()
+
+	config := &rest.Config{Host: execServer.URL}
+	server, errCh := newSessionServer(t, config, func(ts *TerminalSession) error {
+		return ts.Exec(context.TODO(), config, "default", "demo", "app", nil, &ExecOptions{
+			Stdout:   true,
+			Executor: SPDYExecutorType,
+			Shells:   []string{"bash", "sh"},
+		})
+	})
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	var msg TerminalMessage
+	assert.Nil(t, conn.ReadJSON(&msg))
+	assert.Equal(t, TerminalMessage{Op: "shell", Data: "sh"}, msg)
+	assert.Equal(t, "$ ", readStdout(t, conn))
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, [][]string{{"bash"}, {"sh"}, {"sh"}}, commands)
+}
+
+func TestExecDetectShellWebsocket(t *testing.T) {
+	execServer := newExecServer(t, func(req *execRequest) error {
+		if req.Command[0] != "sh" {
+			return fmt.Errorf(`exec: "%s": executable file not found in $PATH`, req.Command[0])
+		}
+		return nil
+	})
+	defer execServer.Close()
+
+	// the shells are probed by the SPDY exec, the session is proxied by the websocket executor
+	commands := make(chan []string, 1)
+	kubelet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			execServer.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		commands <- r.URL.Query()["command"]
+		upgrader := websocket.Upgrader{Subprotocols: []string{"base64.channel.k8s.io"}}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade websocket error, %v", err)
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte("1"+base64.StdEncoding.EncodeToString([]byte("$ "))))
+	}))
+	defer kubelet.Close()
+
+	chosen := make(chan string, 1)
+	config := &rest.Config{Host: kubelet.URL}
+	server, _ := newSessionServer(t, config, func(ts *TerminalSession) error {
+		return ts.Exec(context.TODO(), config, "default", "demo", "app", nil, &ExecOptions{
+			Stdin:       true,
+			Stdout:      true,
+			TTY:         true,
+			Shells:      []string{"bash", "sh"},
+			ShellChosen: func(shell string) { chosen <- shell },
+		})
+	})
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"base64.channel.k8s.io"}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// the first message is the container stdout frame, no shell message is sent
+	conn.SetReadDeadline(time.Now().Add(wait.ForeverTestTimeout))
+	_, msg, err := conn.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "1"+base64.StdEncoding.EncodeToString([]byte("$ ")), string(msg))
+	assert.Equal(t, "sh", <-chosen)
+	assert.Equal(t, []string{"sh"}, <-commands)
+}
@@ -0,0 +1,195 @@
+package terminal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// LogTarget is the container whose logs are streamed.
+type LogTarget struct {
+	Namespace string
+	Pod       string
+	Container string
+}
+
+func (t LogTarget) String() string {
+	return fmt.Sprintf("%s/%s", t.Pod, t.Container)
+}
+
+// LogOptions is the options of streaming the logs.
+type LogOptions struct {
+	Follow     bool
+	TailLines  *int64
+	SinceTime  *metav1.Time
+	Timestamps bool
+	Previous   bool
+	// Prefix prefixes each line with the [pod/container], it's useful to merge the logs of multiple containers.
+	Prefix bool
+	// BytesPerSecond caps the bandwidth of the session, 0 means no limit.
+	BytesPerSecond int
+}
+
+// StreamLogs streams the logs of the targets to the websocket, the lines of all targets are merged.
+// Each line is sent as the stdout TerminalMessage. It returns nil when all the logs are streamed,
+// or the client disconnects, or the session is done, or the ctx is done. The error of writing the
+// websocket is returned otherwise. The nil opts means the default options.
+func (t *TerminalSession) StreamLogs(ctx context.Context, targets []LogTarget, opts *LogOptions) error {
+	if opts == nil {
+		opts = &LogOptions{}
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	closed := make(chan struct{})
+	go t.watchClientClose(streamCtx, cancel, closed)
+
+	lines := make(chan string)
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target LogTarget) {
+			defer wg.Done()
+			errs[i] = t.readLogs(streamCtx, target, opts, lines)
+		}(i, target)
+	}
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	var limiter *rate.Limiter
+	if opts.BytesPerSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.BytesPerSecond), opts.BytesPerSecond)
+	}
+	var writeErr error
+	for line := range lines {
+		if writeErr != nil {
+			continue
+		}
+		if err := waitBandwidth(streamCtx, limiter, len(line)); err != nil {
+			continue
+		}
+		if _, err := t.Write([]byte(line)); err != nil {
+			writeErr = fmt.Errorf("write logs error, %v", err)
+			cancel()
+		}
+	}
+
+	select {
+	case <-closed:
+		// the client disconnected or the session is done
+		return nil
+	default:
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	return t.wsConn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+// readLogs sends the log lines of the target to the lines channel.
+func (t *TerminalSession) readLogs(ctx context.Context, target LogTarget, opts *LogOptions, lines chan<- string) error {
+	stream, err := t.client.CoreV1().Pods(target.Namespace).GetLogs(target.Pod, &corev1.PodLogOptions{
+		Container:  target.Container,
+		Follow:     opts.Follow,
+		TailLines:  opts.TailLines,
+		SinceTime:  opts.SinceTime,
+		Timestamps: opts.Timestamps,
+		Previous:   opts.Previous,
+	}).Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("stream logs of %s error, %v", target, err)
+	}
+	defer stream.Close()
+
+	prefix := ""
+	if opts.Prefix {
+		prefix = fmt.Sprintf("[%s] ", target)
+	}
+
+	reader := bufio.NewReader(stream)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			select {
+			case lines <- prefix + line:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		if err == io.EOF || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read logs of %s error, %v", target, err)
+		}
+	}
+}
+
+// watchClientClose cancels the streaming and closes the closed channel when the client disconnects
+// or the session is done. The messages from the client are discarded.
+func (t *TerminalSession) watchClientClose(ctx context.Context, cancel context.CancelFunc, closed chan<- struct{}) {
+	var once sync.Once
+	closeFn := func() {
+		once.Do(func() {
+			close(closed)
+			cancel()
+		})
+	}
+
+	go func() {
+		select {
+		case <-t.doneChan:
+			closeFn()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		if _, _, err := t.wsConn.ReadMessage(); err != nil {
+			klog.V(5).Infof("logs client closed, %v", err)
+			closeFn()
+			return
+		}
+	}
+}
+
+// waitBandwidth blocks until the n bytes are allowed by the limiter.
+func waitBandwidth(ctx context.Context, limiter *rate.Limiter, n int) error {
+	if limiter == nil {
+		return nil
+	}
+	for n > 0 {
+		size := n
+		if size > limiter.Burst() {
+			size = limiter.Burst()
+		}
+		if err := limiter.WaitN(ctx, size); err != nil {
+			return err
+		}
+		n -= size
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package terminal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStreamLogs(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	errCh := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts, err := NewTerminalSession(client, w, r, nil)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer ts.Close()
+
+		errCh <- ts.StreamLogs(r.Context(), []LogTarget{
+			{Namespace: "default", Pod: "demo-a", Container: "nginx"},
+			{Namespace: "default", Pod: "demo-b", Container: "nginx"},
+		}, &LogOptions{Prefix: true, BytesPerSecond: 1024})
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	var lines []string
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure))
+			break
+		}
+		var msg TerminalMessage
+		assert.Nil(t, json.Unmarshal(data, &msg))
+		assert.Equal(t, "stdout", msg.Op)
+		lines = append(lines, msg.Data)
+	}
+	assert.Nil(t, <-errCh)
+
+	// the fake client returns "fake logs" for every container
+	sort.Strings(lines)
+	assert.Equal(t, []string{"[demo-a/nginx] fake logs", "[demo-b/nginx] fake logs"}, lines)
+}
+
+func TestStreamLogsError(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	targets := []LogTarget{{Namespace: "default", Pod: "demo-a", Container: "nginx"}}
+
+	tests := []struct {
+		name    string
+		stream  func(ts *TerminalSession) error
+		wantErr bool
+	}{
+		{
+			name: "write error",
+			stream: func(ts *TerminalSession) error {
+				// the writes fail but the client is still connected
+				ts.wsConn.SetWriteDeadline(time.Now().Add(-time.Second))
+				return ts.StreamLogs(context.TODO(), targets, &LogOptions{})
+			},
+			wantErr: true,
+		},
+		{
+			name: "nil options",
+			stream: func(ts *TerminalSession) error {
+				return ts.StreamLogs(context.TODO(), targets, nil)
+			},
+		},
+		{
+			name: "ctx cancelled",
+			stream: func(ts *TerminalSession) error {
+				ctx, cancel := context.WithCancel(context.TODO())
+				cancel()
+				return ts.StreamLogs(ctx, targets, &LogOptions{})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errCh := make(chan error, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ts, err := NewTerminalSession(client, w, r, nil)
+				if err != nil {
+					errCh <- err
+					return
+				}
+				defer ts.Close()
+				errCh <- tt.stream(ts)
+			}))
+			defer server.Close()
+
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			assert.Nil(t, err)
+			defer conn.Close()
+
+			err = <-errCh
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				assert.Contains(t, err.Error(), "write logs error")
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package terminal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pytimer/k8sutil/wsremotecommand"
+	"k8s.io/klog/v2"
+)
+
+// Recorder records the input, output and resize events of the terminal session.
+type Recorder = wsremotecommand.Recorder
+
+// The event types of the asciicast v2 format.
+const (
+	CastOutputEvent = "o"
+	CastInputEvent  = "i"
+	CastResizeEvent = "r"
+)
+
+// CastHeader is the header line of the asciicast v2 format.
+type CastHeader struct {
+	Version   int               `json:"version"`
+	Width     uint16            `json:"width"`
+	Height    uint16            `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// CastRecorder records the terminal session in the asciicast v2 format, see
+// https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md.
+// The output and resize events are written to the output writer, and the stdin keystrokes
+// are written to the stdin writer if it's set.
+type CastRecorder struct {
+	mu     sync.Mutex
+	start  time.Time
+	header CastHeader
+	output io.Writer
+	stdin  io.Writer
+}
+
+var _ Recorder = &CastRecorder{}
+
+// NewCastRecorder writes the header to w and returns the recorder.
+func NewCastRecorder(w io.Writer, header CastHeader) (*CastRecorder, error) {
+	r := &CastRecorder{
+		start:  time.Now(),
+		header: header,
+		output: w,
+	}
+	r.header.Version = 2
+	if r.header.Timestamp == 0 {
+		r.header.Timestamp = r.start.Unix()
+	}
+
+	if err := writeCastLine(w, r.header); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// WithStdin records the stdin keystrokes to w separately, w is another asciicast v2 stream.
+func (r *CastRecorder) WithStdin(w io.Writer) (*CastRecorder, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := writeCastLine(w, r.header); err != nil {
+		return nil, err
+	}
+	r.stdin = w
+	return r, nil
+}
+
+func (r *CastRecorder) RecordInput(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stdin == nil {
+		return
+	}
+	r.writeEvent(r.stdin, CastInputEvent, string(data))
+}
+
+func (r *CastRecorder) RecordOutput(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeEvent(r.output, CastOutputEvent, string(data))
+}
+
+func (r *CastRecorder) RecordResize(width, height uint16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeEvent(r.output, CastResizeEvent, fmt.Sprintf("%dx%d", width, height))
+}
+
+// writeEvent writes the event line [time, type, data], the recording error doesn't break the session.
+func (r *CastRecorder) writeEvent(w io.Writer, eventType, data string) {
+	elapsed := time.Since(r.start).Seconds()
+	if err := writeCastLine(w, []interface{}{elapsed, eventType, data}); err != nil {
+		klog.Errorf("record %s event error, %v", eventType, err)
+	}
+}
+
+func writeCastLine(w io.Writer, v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,43 @@
+package terminal
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCastRecorder(t *testing.T) {
+	output := &bytes.Buffer{}
+	stdin := &bytes.Buffer{}
+	r, err := NewCastRecorder(output, CastHeader{Width: 80, Height: 24, Title: "default/demo"})
+	assert.Nil(t, err)
+	_, err = r.WithStdin(stdin)
+	assert.Nil(t, err)
+
+	r.RecordInput([]byte("ls\r"))
+	r.RecordOutput([]byte("bin etc\r\n"))
+	r.RecordResize(120, 40)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+
+	var header CastHeader
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &header))
+	assert.Equal(t, 2, header.Version)
+	assert.Equal(t, uint16(80), header.Width)
+	assert.NotZero(t, header.Timestamp)
+
+	var event []interface{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, []interface{}{CastOutputEvent, "bin etc\r\n"}, event[1:])
+	assert.Nil(t, json.Unmarshal([]byte(lines[2]), &event))
+	assert.Equal(t, []interface{}{CastResizeEvent, "120x40"}, event[1:])
+
+	lines = strings.Split(strings.TrimSpace(stdin.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, []interface{}{CastInputEvent, "ls\r"}, event[1:])
+}
@@ -0,0 +1,62 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+// DefaultShells is the shells tried in order by the shell detection. Every shell tried costs an exec
+// round trip, put the shell most likely to exist first.
+var DefaultShells = []string{"bash", "sh", "ash", "powershell", "cmd"}
+
+// shellProbeTimeout is the timeout of probing a shell, the shell exits at once without stdin.
+const shellProbeTimeout = 10 * time.Second
+
+// probeShell runs the shell without stdin, the shell exits at once if it exists. The stdout is discarded,
+// it's requested because the exec without any stream is rejected.
+var probeShell = func(ctx context.Context, config *rest.Config, namespace, podName, containerName, shell string) error {
+	return streamExec(ctx, config, namespace, podName, containerName, []string{shell}, nil, io.Discard, nil)
+}
+
+// detectShell returns the first shell which exists in the container. Each shell is probed by an exec
+// without stdin before the session exec, so it costs up to len(shells) extra execs.
+func detectShell(ctx context.Context, config *rest.Config, namespace, podName, containerName string, shells []string) (string, error) {
+	for _, shell := range shells {
+		probeCtx, cancel := context.WithTimeout(ctx, shellProbeTimeout)
+		err := probeShell(probeCtx, config, namespace, podName, containerName, shell)
+		cancel()
+
+		if err == nil {
+			return shell, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if err == context.DeadlineExceeded {
+			return "", fmt.Errorf("probing shell %s in container %s timed out after %s", shell, containerName, shellProbeTimeout)
+		}
+		if !isExecutableNotFound(err) {
+			// the shell exists but exited with error, such as the non-zero exit code
+			if _, err := exitCode(err); err == nil {
+				return shell, nil
+			}
+			return "", err
+		}
+		klog.V(5).Infof("shell %s not found in container %s, %v", shell, containerName, err)
+	}
+	return "", fmt.Errorf("no shell of %v found in container %s", shells, containerName)
+}
+
+// isExecutableNotFound returns true if the exec fails because the command doesn't exist in the container.
+func isExecutableNotFound(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "executable file not found") ||
+		strings.Contains(msg, "no such file or directory") ||
+		strings.Contains(msg, "cannot find the file specified")
+}
@@ -0,0 +1,44 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/exec"
+)
+
+func TestDetectShell(t *testing.T) {
+	defer func(probe func(context.Context, *rest.Config, string, string, string, string) error) {
+		probeShell = probe
+	}(probeShell)
+
+	results := map[string]error{
+		"bash": fmt.Errorf(`OCI runtime exec failed: exec failed: container_linux.go:380: starting container process caused: exec: "bash": executable file not found in $PATH: unknown`),
+		"sh":   fmt.Errorf(`exec: "sh": stat sh: no such file or directory`),
+		"ash":  exec.CodeExitError{Err: fmt.Errorf("command terminated with non-zero exit code"), Code: 1},
+	}
+	var probed []string
+	probeShell = func(_ context.Context, _ *rest.Config, _, _, _, shell string) error {
+		probed = append(probed, shell)
+		return results[shell]
+	}
+
+	shell, err := detectShell(context.TODO(), &rest.Config{}, "default", "demo", "app", DefaultShells)
+	assert.Nil(t, err)
+	assert.Equal(t, "ash", shell)
+	assert.Equal(t, []string{"bash", "sh", "ash"}, probed)
+
+	_, err = detectShell(context.TODO(), &rest.Config{}, "default", "demo", "app", []string{"bash", "sh"})
+	assert.EqualError(t, err, "no shell of [bash sh] found in container app")
+
+	results["bash"] = context.DeadlineExceeded
+	_, err = detectShell(context.TODO(), &rest.Config{}, "default", "demo", "app", DefaultShells)
+	assert.EqualError(t, err, "probing shell bash in container app timed out after 10s")
+
+	results["bash"] = fmt.Errorf("pods \"demo\" not found")
+	_, err = detectShell(context.TODO(), &rest.Config{}, "default", "demo", "app", DefaultShells)
+	assert.EqualError(t, err, "pods \"demo\" not found")
+}
@@ -5,11 +5,11 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
-	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/pytimer/k8sutil/wsremotecommand"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/remotecommand"
 	"k8s.io/klog/v2"
 )
@@ -24,19 +24,28 @@ const (
 	SPDYExecutorType      ExecutorType = "spdy"
 )
 
-var upgrader = websocket.Upgrader{
-	HandshakeTimeout: 10 * time.Second,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
 type ExecOptions struct {
 	Stdin    bool
 	Stdout   bool
 	Stderr   bool
 	TTY      bool
 	Executor ExecutorType
+	// Shells are tried in order when the exec command is empty, the first shell exists in the container
+	// is chosen, such as the DefaultShells. Each shell is probed by an extra exec before the session starts.
+	// The chosen shell is reported to the frontend by the shell message, except with the websocket executor
+	// which proxies the container stream as is.
+	Shells []string
+	// ShellChosen is called with the shell chosen by the shell detection before the session starts,
+	// with every executor. It's the way to get the shell with the websocket executor, which sends no shell message.
+	ShellChosen func(shell string)
+	// Impersonate is the end user of the session, the exec and attach are sent as the user,
+	// and fail fast if the user isn't allowed by the SelfSubjectAccessReview.
+	Impersonate *rest.ImpersonationConfig
+}
+
+// websocketExecutor returns true if the container stream is proxied by the websocket executor.
+func (o *ExecOptions) websocketExecutor() bool {
+	return o.TTY && (o.Executor == WebsocketExecutorType || o.Executor == "")
 }
 
 type TerminalSession struct {
@@ -45,15 +54,37 @@ type TerminalSession struct {
 	doneChan chan struct{}
 	client   kubernetes.Interface
 	once     sync.Once
+	recorder Recorder
+	auditor  *CommandAuditor
+	// interceptor is created by the auditor for the container when exec
+	interceptor *commandInterceptor
+	// writeMu serializes the writes of the websocket, the stdout and stderr are written concurrently without TTY
+	writeMu sync.Mutex
 }
 
+// NewTerminalSession upgrades the request to the websocket, all origins are allowed.
+// Use NewTerminalSessionWithOptions to check the origin and authenticate the request.
 func NewTerminalSession(c kubernetes.Interface, w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*TerminalSession, error) {
-	subprotocols := websocket.Subprotocols(r)
-	conn, err := upgrader.Upgrade(w, r, responseHeader)
+	return NewTerminalSessionWithOptions(c, w, r, responseHeader, &UpgradeOptions{CheckOrigin: allowAllOrigins})
+}
+
+// NewTerminalSessionWithOptions upgrades the request to the websocket with the options, the nil opts means the default options.
+func NewTerminalSessionWithOptions(c kubernetes.Interface, w http.ResponseWriter, r *http.Request, responseHeader http.Header, opts *UpgradeOptions) (*TerminalSession, error) {
+	if opts == nil {
+		opts = &UpgradeOptions{}
+	}
+
+	if opts.Authenticate != nil {
+		if err := opts.Authenticate(r); err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return nil, fmt.Errorf("authenticate websocket request error, %v", err)
+		}
+	}
+
+	conn, err := opts.upgrader(r).Upgrade(w, r, responseHeader)
 	if err != nil {
 		return nil, err
 	}
-	upgrader.Subprotocols = subprotocols
 
 	return &TerminalSession{
 		wsConn:   conn,
@@ -63,6 +94,18 @@ func NewTerminalSession(c kubernetes.Interface, w http.ResponseWriter, r *http.R
 	}, nil
 }
 
+// WithRecorder records the session with the recorder, such as the CastRecorder.
+func (t *TerminalSession) WithRecorder(r Recorder) *TerminalSession {
+	t.recorder = r
+	return t
+}
+
+// WithCommandAuditor audits the command lines entered in the session, and rejects the denied commands.
+func (t *TerminalSession) WithCommandAuditor(a *CommandAuditor) *TerminalSession {
+	t.auditor = a
+	return t
+}
+
 func (t *TerminalSession) Close() error {
 	return t.wsConn.Close()
 }
@@ -98,8 +141,24 @@ func (t *TerminalSession) Read(p []byte) (n int, err error) {
 
 	switch msg.Op {
 	case "stdin":
-		return copy(p, msg.Data), nil
+		data := []byte(msg.Data)
+		if t.recorder != nil {
+			t.recorder.RecordInput(data)
+		}
+		if t.interceptor != nil {
+			var reply []byte
+			data, reply = t.interceptor.Intercept(data)
+			if len(reply) > 0 {
+				if _, err := t.Write(reply); err != nil {
+					return copy(p, EndOfTransmission), err
+				}
+			}
+		}
+		return copy(p, data), nil
 	case "resize":
+		if t.recorder != nil {
+			t.recorder.RecordResize(msg.Cols, msg.Rows)
+		}
 		t.sizeChan <- remotecommand.TerminalSize{Width: msg.Cols, Height: msg.Rows}
 		return 0, nil
 	case "ping":
@@ -120,13 +179,25 @@ func (t *TerminalSession) Write(p []byte) (n int, err error) {
 		return 0, err
 	}
 	klog.V(8).Info(string(p))
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
 	if err := t.wsConn.WriteMessage(websocket.TextMessage, msg); err != nil {
 		klog.Errorf("write message err: %v", err)
 		return 0, err
 	}
+	if t.recorder != nil {
+		t.recorder.RecordOutput(p)
+	}
 	return len(p), nil
 }
 
+// writeJSON sends the message to the frontend, it's serialized with the Write.
+func (t *TerminalSession) writeJSON(msg TerminalMessage) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return t.wsConn.WriteJSON(msg)
+}
+
 func (t *TerminalSession) Next() *remotecommand.TerminalSize {
 	select {
 	case size := <-t.sizeChan:
@@ -144,6 +215,7 @@ func (t *TerminalSession) Next() *remotecommand.TerminalSize {
 // bind    fe->be     SessionID      Id sent back from TerminalResponse
 // stdin   fe->be     Data           Keystrokes/paste buffer
 // resize  fe->be     Rows, Cols     New terminal size
+// shell   be->fe     Data           The shell chosen by the shell detection, not sent with the websocket executor
 // stdout  be->fe     Data           Output from the process
 type TerminalMessage struct {
 	Op   string `json:"op"`
@@ -0,0 +1,72 @@
+package terminal
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultHandshakeTimeout is the default timeout of the websocket handshake.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// UpgradeOptions is the options of upgrading the HTTP request to the websocket of the terminal session.
+// A new websocket upgrader is created for every session, so the options are safe for the concurrent sessions.
+type UpgradeOptions struct {
+	// Authenticate is called before the upgrade, the request is rejected with 401 if it returns error.
+	Authenticate func(r *http.Request) error
+	// AllowedOrigins is the origins allowed to connect, such as "https://console.example.com", "*" allows all origins.
+	// It's ignored if the CheckOrigin is set. The same origin check is used if both of them are empty.
+	AllowedOrigins []string
+	CheckOrigin    func(r *http.Request) bool
+	// Subprotocols is the server supported protocols in order of preference. If it's empty,
+	// the first protocol requested by the client is chosen.
+	Subprotocols     []string
+	ReadBufferSize   int
+	WriteBufferSize  int
+	HandshakeTimeout time.Duration
+}
+
+// upgrader returns the websocket upgrader of the request.
+func (o *UpgradeOptions) upgrader(r *http.Request) *websocket.Upgrader {
+	u := &websocket.Upgrader{
+		HandshakeTimeout: o.HandshakeTimeout,
+		ReadBufferSize:   o.ReadBufferSize,
+		WriteBufferSize:  o.WriteBufferSize,
+		Subprotocols:     o.Subprotocols,
+		CheckOrigin:      o.CheckOrigin,
+	}
+	if u.HandshakeTimeout == 0 {
+		u.HandshakeTimeout = DefaultHandshakeTimeout
+	}
+	if len(u.Subprotocols) == 0 {
+		u.Subprotocols = websocket.Subprotocols(r)
+	}
+	if u.CheckOrigin == nil && len(o.AllowedOrigins) > 0 {
+		u.CheckOrigin = allowedOrigins(o.AllowedOrigins)
+	}
+	return u
+}
+
+// allowedOrigins returns the CheckOrigin allows the origins. The request without the Origin header is allowed,
+// it isn't from the browser.
+func allowedOrigins(origins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, o := range origins {
+			if o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// allowAllOrigins is the CheckOrigin of the NewTerminalSession.
+func allowAllOrigins(r *http.Request) bool {
+	return true
+}
@@ -0,0 +1,57 @@
+package terminal
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNewTerminalSessionWithOptions(t *testing.T) {
+	opts := &UpgradeOptions{
+		AllowedOrigins: []string{"https://console.example.com"},
+		Authenticate: func(r *http.Request) error {
+			if r.Header.Get("Authorization") != "Bearer token" {
+				return fmt.Errorf("invalid token")
+			}
+			return nil
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts, err := NewTerminalSessionWithOptions(fake.NewSimpleClientset(), w, r, nil, opts)
+		if err != nil {
+			return
+		}
+		ts.Close()
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	dial := func(origin, token string, protocols ...string) (*websocket.Conn, int) {
+		header := http.Header{}
+		header.Set("Origin", origin)
+		header.Set("Authorization", "Bearer "+token)
+		dialer := websocket.Dialer{Subprotocols: protocols}
+		conn, resp, err := dialer.Dial(url, header)
+		if err != nil {
+			return nil, resp.StatusCode
+		}
+		conn.Close()
+		return conn, resp.StatusCode
+	}
+
+	conn, code := dial("https://console.example.com", "token", "base64.channel.k8s.io")
+	assert.Equal(t, http.StatusSwitchingProtocols, code)
+	assert.Equal(t, "base64.channel.k8s.io", conn.Subprotocol())
+
+	_, code = dial("https://evil.example.com", "token")
+	assert.Equal(t, http.StatusForbidden, code)
+
+	_, code = dial("https://console.example.com", "invalid")
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
@@ -0,0 +1,109 @@
+package wsremotecommand
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// The channels of the kubernetes remote command websocket protocol.
+const (
+	StdinChannel byte = iota
+	StdoutChannel
+	StderrChannel
+	ErrorChannel
+	ResizeChannel
+)
+
+// Recorder records the input, output and resize events of the terminal stream.
+type Recorder interface {
+	RecordInput(data []byte)
+	RecordOutput(data []byte)
+	RecordResize(width, height uint16)
+}
+
+// StdinInterceptor intercepts the stdin data before it's sent to the container, and returns the data
+// to send. The reply is written back to the client as the stdout if it's not empty, such as the notice
+// of the rejected command.
+type StdinInterceptor interface {
+	Intercept(data []byte) (send []byte, reply []byte)
+}
+
+// decodeFrame returns the channel and the payload of the websocket message. The base64 protocols
+// prefix the message with the channel character, the binary protocols prefix it with the channel byte.
+func decodeFrame(subprotocol string, msg []byte) (byte, []byte, error) {
+	if len(msg) == 0 {
+		return 0, nil, fmt.Errorf("empty message")
+	}
+
+	if !strings.Contains(subprotocol, "base64") {
+		return msg[0], msg[1:], nil
+	}
+
+	channel := msg[0] - '0'
+	data, err := base64.StdEncoding.DecodeString(string(msg[1:]))
+	if err != nil {
+		return 0, nil, fmt.Errorf("decode channel %d message error, %v", channel, err)
+	}
+	return channel, data, nil
+}
+
+// encodeFrame encodes the payload to the websocket message of the channel.
+func encodeFrame(subprotocol string, channel byte, data []byte) []byte {
+	if !strings.Contains(subprotocol, "base64") {
+		return append([]byte{channel}, data...)
+	}
+	return append([]byte{'0' + channel}, base64.StdEncoding.EncodeToString(data)...)
+}
+
+// interceptFrame passes the stdin payload of the message to the interceptor, and returns the
+// message to send and the stdout message replied to the client, the reply is nil if the interceptor
+// has nothing to reply. The other channels messages are returned as is.
+func interceptFrame(interceptor StdinInterceptor, subprotocol string, msg []byte) ([]byte, []byte) {
+	if interceptor == nil || len(msg) == 0 {
+		return msg, nil
+	}
+
+	channel, data, err := decodeFrame(subprotocol, msg)
+	if err != nil || channel != StdinChannel {
+		return msg, nil
+	}
+	send, reply := interceptor.Intercept(data)
+	if len(reply) == 0 {
+		return encodeFrame(subprotocol, channel, send), nil
+	}
+	return encodeFrame(subprotocol, channel, send), encodeFrame(subprotocol, StdoutChannel, reply)
+}
+
+// recordFrame records the stdin, stdout, stderr and resize messages of the stream.
+func recordFrame(recorder Recorder, subprotocol string, msg []byte) {
+	if recorder == nil || len(msg) == 0 {
+		return
+	}
+
+	channel, data, err := decodeFrame(subprotocol, msg)
+	if err != nil {
+		klog.V(5).Infof("skip recording message, %v", err)
+		return
+	}
+
+	switch channel {
+	case StdinChannel:
+		recorder.RecordInput(data)
+	case StdoutChannel, StderrChannel:
+		recorder.RecordOutput(data)
+	case ResizeChannel:
+		var size struct {
+			Width  uint16
+			Height uint16
+		}
+		if err := json.Unmarshal(data, &size); err != nil {
+			klog.V(5).Infof("skip recording resize message, %v", err)
+			return
+		}
+		recorder.RecordResize(size.Width, size.Height)
+	}
+}
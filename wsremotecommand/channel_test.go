@@ -0,0 +1,68 @@
+package wsremotecommand
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apiserver/pkg/util/wsstream"
+)
+
+type fakeRecorder struct {
+	events []string
+}
+
+func (r *fakeRecorder) RecordInput(data []byte) {
+	r.events = append(r.events, "i:"+string(data))
+}
+
+func (r *fakeRecorder) RecordOutput(data []byte) {
+	r.events = append(r.events, "o:"+string(data))
+}
+
+func (r *fakeRecorder) RecordResize(width, height uint16) {
+	r.events = append(r.events, fmt.Sprintf("r:%dx%d", width, height))
+}
+
+func TestRecordFrame(t *testing.T) {
+	encode := func(channel byte, data string) []byte {
+		return []byte(string('0'+channel) + base64.StdEncoding.EncodeToString([]byte(data)))
+	}
+
+	r := &fakeRecorder{}
+	recordFrame(r, wsstream.Base64ChannelWebSocketProtocol, encode(StdinChannel, "ls\r"))
+	recordFrame(r, wsstream.Base64ChannelWebSocketProtocol, encode(StdoutChannel, "bin\r\n"))
+	recordFrame(r, wsstream.Base64ChannelWebSocketProtocol, encode(ResizeChannel, `{"Width":80,"Height":24}`))
+	recordFrame(r, wsstream.Base64ChannelWebSocketProtocol, encode(ErrorChannel, "{}"))
+	recordFrame(r, wsstream.ChannelWebSocketProtocol, append([]byte{StderrChannel}, "error\r\n"...))
+	recordFrame(r, wsstream.Base64ChannelWebSocketProtocol, []byte("1!invalid"))
+
+	assert.Equal(t, []string{"i:ls\r", "o:bin\r\n", "r:80x24", "o:error\r\n"}, r.events)
+}
+
+// denyInterceptor replaces the stdin "x" with the "y" and replies the notice.
+type denyInterceptor struct{}
+
+func (denyInterceptor) Intercept(data []byte) ([]byte, []byte) {
+	if string(data) == "x" {
+		return []byte("y"), []byte("denied")
+	}
+	return data, nil
+}
+
+func TestInterceptFrame(t *testing.T) {
+	protocol := wsstream.Base64ChannelWebSocketProtocol
+	send, reply := interceptFrame(denyInterceptor{}, protocol, encodeFrame(protocol, StdinChannel, []byte("x")))
+	assert.Equal(t, encodeFrame(protocol, StdinChannel, []byte("y")), send)
+	assert.Equal(t, encodeFrame(protocol, StdoutChannel, []byte("denied")), reply)
+
+	send, reply = interceptFrame(denyInterceptor{}, protocol, encodeFrame(protocol, StdinChannel, []byte("ls")))
+	assert.Equal(t, encodeFrame(protocol, StdinChannel, []byte("ls")), send)
+	assert.Nil(t, reply)
+
+	resize := encodeFrame(protocol, ResizeChannel, []byte(`{"Width":80,"Height":24}`))
+	send, reply = interceptFrame(denyInterceptor{}, protocol, resize)
+	assert.Equal(t, resize, send)
+	assert.Nil(t, reply)
+}
@@ -12,10 +12,14 @@ type streamer struct {
 	// web -> server
 	remoteStdin *websocket.Conn
 	// server -> web
-	proxyStream       *websocket.Conn
-	errorChan         chan error
-	recordCommandChan chan string
-	subprotocol       string
+	proxyStream *websocket.Conn
+	errorChan   chan error
+	recorder    Recorder
+	interceptor StdinInterceptor
+	subprotocol string
+	// writeMu serializes the writes to the remoteStdin, the stdout and the replies of the interceptor
+	// are written concurrently
+	writeMu sync.Mutex
 }
 
 func (s *streamer) stream(conn *websocket.Conn) error {
@@ -59,11 +63,19 @@ func (s *streamer) copyStdin(wg *sync.WaitGroup) {
 				break
 			}
 
+			recordFrame(s.recorder, s.subprotocol, msg)
+			msg, reply := interceptFrame(s.interceptor, s.subprotocol, msg)
 			if err := s.proxyStream.WriteMessage(msgType, msg); err != nil {
 				klog.Error(err)
 				s.errorChan <- err
 				return
 			}
+			if reply != nil {
+				recordFrame(s.recorder, s.subprotocol, reply)
+				if err := s.writeRemote(msgType, reply); err != nil {
+					klog.Error(err)
+				}
+			}
 		}
 	}()
 
@@ -77,14 +89,16 @@ func (s *streamer) copyStdout(wg *sync.WaitGroup) {
 			msgType, msg, err := s.proxyStream.ReadMessage()
 			if err != nil {
 				m := formatCloseMessage(err)
-				if err := s.remoteStdin.WriteMessage(websocket.CloseMessage, m); err != nil {
+				if err := s.writeRemote(websocket.CloseMessage, m); err != nil {
 					klog.Error(err)
 					s.errorChan <- err
 					return
 				}
 				break
 			}
-			if err := s.remoteStdin.WriteMessage(msgType, msg); err != nil {
+
+			recordFrame(s.recorder, s.subprotocol, msg)
+			if err := s.writeRemote(msgType, msg); err != nil {
 				klog.Error(err)
 				break
 			}
@@ -92,6 +106,12 @@ func (s *streamer) copyStdout(wg *sync.WaitGroup) {
 	}()
 }
 
+func (s *streamer) writeRemote(msgType int, msg []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.remoteStdin.WriteMessage(msgType, msg)
+}
+
 func formatCloseMessage(err error) []byte {
 	m := websocket.FormatCloseMessage(websocket.CloseAbnormalClosure, err.Error())
 	if e, ok := err.(*websocket.CloseError); ok {
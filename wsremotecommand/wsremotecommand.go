@@ -17,6 +17,10 @@ import (
 // StreamOptions holds information pertaining to the current streaming session: input/output streams
 type StreamOptions struct {
 	Stdin *websocket.Conn
+	// Recorder records the stream if it's not nil.
+	Recorder Recorder
+	// StdinInterceptor intercepts the stdin before it's sent to the container if it's not nil.
+	StdinInterceptor StdinInterceptor
 }
 
 type Executor struct {
@@ -28,7 +32,30 @@ type Executor struct {
 	protocols []string
 }
 
-func NewWebSocketExecutor(config *rest.Config, url *url.URL, protocols []string) (*Executor, error) {
+type executorOptions struct {
+	impersonate *rest.ImpersonationConfig
+}
+
+// ExecutorOption configures the websocket executor.
+type ExecutorOption func(*executorOptions)
+
+// WithImpersonation sends the requests as the impersonated user, groups and extra.
+func WithImpersonation(impersonate rest.ImpersonationConfig) ExecutorOption {
+	return func(o *executorOptions) {
+		o.impersonate = &impersonate
+	}
+}
+
+func NewWebSocketExecutor(config *rest.Config, url *url.URL, protocols []string, opts ...ExecutorOption) (*Executor, error) {
+	options := &executorOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.impersonate != nil {
+		config = rest.CopyConfig(config)
+		config.Impersonate = *options.impersonate
+	}
+
 	upgradeRoundTripper, wrapper, err := RoundTripperFor(config)
 	if err != nil {
 		return nil, err
@@ -85,6 +112,8 @@ func (e *Executor) Stream(options StreamOptions) error {
 	s := streamer{
 		remoteStdin: options.Stdin,
 		errorChan:   make(chan error),
+		recorder:    options.Recorder,
+		interceptor: options.StdinInterceptor,
 		subprotocol: e.Upgrader.Conn.Subprotocol(),
 	}
 
@@ -0,0 +1,42 @@
+package wsremotecommand
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/rest"
+)
+
+func TestNewWebSocketExecutorWithImpersonation(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	assert.Nil(t, err)
+	executor, err := NewWebSocketExecutor(&rest.Config{Host: server.URL}, u, nil,
+		WithImpersonation(rest.ImpersonationConfig{UserName: "alice", Groups: []string{"dev"}}))
+	assert.Nil(t, err)
+
+	req, err := http.NewRequest(executor.method, executor.url.String(), nil)
+	assert.Nil(t, err)
+	_, err = executor.transport.RoundTrip(req)
+	assert.Nil(t, err)
+	defer executor.Upgrader.Conn.Close()
+
+	header := <-headers
+	assert.Equal(t, "alice", header.Get("Impersonate-User"))
+	assert.Equal(t, "dev", header.Get("Impersonate-Group"))
+}